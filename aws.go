@@ -10,7 +10,7 @@ func (l *StandardLogger) LogAPIGatewayProxyRequest(event events.APIGatewayProxyR
 	var message = "Received API Gateway Proxy Request."
 
 	if event.Body != "" {
-		l.CustomFields["http.body"] = event.Body
+		l.CustomFields[HTTPBodyField] = event.Body
 	}
 
 	email, _ := ReadEmailFromAPIGatewayProxyRequestEvent(event)
@@ -25,13 +25,13 @@ func (l *StandardLogger) LogAPIGatewayProxyRequest(event events.APIGatewayProxyR
 		headers[key] = value
 	}
 
-	l.CustomFields["http.query_parameters"] = event.QueryStringParameters
-	l.CustomFields["http.path_parameters"] = event.PathParameters
-	l.CustomFields["http.headers"] = headers
-	l.CustomFields["http.method"] = event.HTTPMethod
-	l.CustomFields["http.url"] = event.Path
-	l.CustomFields["user.name"] = email
-	l.AddCustomFields().Debug(message)
+	l.CustomFields[HTTPQueryParametersField] = event.QueryStringParameters
+	l.CustomFields[HTTPPathParametersField] = event.PathParameters
+	l.CustomFields[HTTPHeadersField] = headers
+	l.CustomFields[HTTPMethodField] = event.HTTPMethod
+	l.CustomFields[HTTPURLField] = event.Path
+	l.CustomFields[UserNameField] = email
+	l.SendDebugLog(message, nil)
 }
 
 func getClaimsFromAPIGW(event events.APIGatewayProxyRequest) (map[string]interface{}, error) {
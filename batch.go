@@ -0,0 +1,259 @@
+package logpet
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// BatchConfig controls how log entries are grouped before being shipped.
+type BatchConfig struct {
+	// MaxEntries is the maximum number of entries in a single batch.
+	MaxEntries int
+	// MaxBytes is the maximum size of a single batch payload, in bytes.
+	MaxBytes int
+	// MaxLinger is the maximum time an entry waits in a batch before it's shipped.
+	MaxLinger time.Duration
+	// MaxPending is the maximum number of batches waiting to be shipped while the destination
+	// is slow or failing, the oldest one is dropped or saved offline beyond it.
+	MaxPending int
+}
+
+// DefaultBatchConfig returns the batch configuration used by SetupDataDogLogger
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		MaxEntries: DataDogMaxBatchEntries,
+		MaxBytes:   DataDogMaxBatchBytes,
+		MaxLinger:  defaultBatchLinger,
+		MaxPending: defaultBatchMaxPending,
+	}
+}
+
+// withDefaults returns a copy of the config with zero values replaced by the defaults
+func (c BatchConfig) withDefaults() BatchConfig {
+	defaults := DefaultBatchConfig()
+
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = defaults.MaxEntries
+	}
+
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = defaults.MaxBytes
+	}
+
+	if c.MaxLinger <= 0 {
+		c.MaxLinger = defaults.MaxLinger
+	}
+
+	if c.MaxPending <= 0 {
+		c.MaxPending = defaults.MaxPending
+	}
+
+	return c
+}
+
+// withDataDogLimits returns a copy of the config with zero values replaced by the defaults
+// and every limit capped to the ones accepted by the DataDog intake.
+func (c BatchConfig) withDataDogLimits() BatchConfig {
+	if c.MaxEntries <= 0 || c.MaxEntries > DataDogMaxBatchEntries {
+		c.MaxEntries = DataDogMaxBatchEntries
+	}
+
+	if c.MaxBytes <= 0 || c.MaxBytes > DataDogMaxBatchBytes {
+		c.MaxBytes = DataDogMaxBatchBytes
+	}
+
+	if c.MaxLinger <= 0 {
+		c.MaxLinger = defaultBatchLinger
+	}
+
+	if c.MaxPending <= 0 {
+		c.MaxPending = defaultBatchMaxPending
+	}
+
+	return c
+}
+
+// batcher groups encoded entries and hands the full batches to a shipping goroutine, which calls
+// flushFn for one batch at a time and in order, so a slow destination never blocks the caller.
+// When MaxPending batches are waiting the oldest one is handed to dropFn instead, which is called
+// with the batcher locked.
+type batcher struct {
+	mu      sync.Mutex
+	config  BatchConfig
+	items   [][]byte
+	size    int
+	timer   *time.Timer
+	pending []pendingBatch
+	// shipping is whether the shipping goroutine is running
+	shipping bool
+	// handedOff and shipped are the sequence numbers of the last batch handed off and
+	// of the last batch shipped or dropped
+	handedOff uint64
+	shipped   uint64
+	// errSeq is the sequence number of the last failed batch and err its error
+	errSeq uint64
+	err    error
+	// shippedCh is closed and replaced every time a batch is shipped
+	shippedCh chan struct{}
+	// ctx is used to ship every batch
+	ctx     context.Context
+	flushFn func(ctx context.Context, batch [][]byte) error
+	dropFn  func(batch [][]byte)
+}
+
+// pendingBatch is a full batch waiting to be shipped
+type pendingBatch struct {
+	seq   uint64
+	items [][]byte
+}
+
+func newBatcher(config BatchConfig, ctx context.Context, flushFn func(ctx context.Context, batch [][]byte) error, dropFn func(batch [][]byte)) *batcher {
+	return &batcher{
+		config:    config,
+		shippedCh: make(chan struct{}),
+		ctx:       ctx,
+		flushFn:   flushFn,
+		dropFn:    dropFn,
+	}
+}
+
+// setConfig replaces the batch limits, the new values apply from the next entry
+func (b *batcher) setConfig(config BatchConfig) {
+	b.mu.Lock()
+	b.config = config
+	b.mu.Unlock()
+}
+
+// add appends an encoded entry to the current batch, handing it off first if the entry
+// doesn't fit and afterwards if the batch is full.
+func (b *batcher) add(item []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.items) > 0 && b.payloadSize(len(item), 1) > b.config.MaxBytes {
+		b.handOff()
+	}
+
+	b.items = append(b.items, item)
+	b.size += len(item)
+
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.config.MaxLinger, func() {
+			b.mu.Lock()
+			b.handOff()
+			b.mu.Unlock()
+		})
+	}
+
+	if len(b.items) >= b.config.MaxEntries || b.payloadSize(0, 0) >= b.config.MaxBytes {
+		b.handOff()
+	}
+}
+
+// payloadSize returns the size of the JSON array built from the current items
+// plus extraItems more items of extraBytes total. Must be called with mu held.
+func (b *batcher) payloadSize(extraBytes, extraItems int) int {
+	count := len(b.items) + extraItems
+	if count == 0 {
+		return 0
+	}
+
+	// brackets plus one comma between each item
+	return b.size + extraBytes + 2 + count - 1
+}
+
+// handOff moves the current batch, if any, to the batches waiting to be shipped,
+// starting the shipping goroutine if needed. Must be called with mu held.
+func (b *batcher) handOff() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	if len(b.items) == 0 {
+		return
+	}
+
+	if len(b.pending) >= b.config.MaxPending {
+		dropped := b.pending[0]
+		b.pending = b.pending[1:]
+		if b.dropFn != nil {
+			b.dropFn(dropped.items)
+		}
+	}
+
+	b.handedOff++
+	b.pending = append(b.pending, pendingBatch{seq: b.handedOff, items: b.items})
+	b.items = nil
+	b.size = 0
+
+	if !b.shipping {
+		b.shipping = true
+		go b.ship()
+	}
+}
+
+// ship ships the waiting batches in order, returning when there are no more
+func (b *batcher) ship() {
+	for {
+		b.mu.Lock()
+		if len(b.pending) == 0 {
+			b.shipping = false
+			b.mu.Unlock()
+			return
+		}
+
+		batch := b.pending[0]
+		b.pending = b.pending[1:]
+		b.mu.Unlock()
+
+		err := b.flushFn(b.ctx, batch.items)
+		if err != nil {
+			log.Printf("unable to ship log batch, %v", err)
+		}
+
+		b.mu.Lock()
+		b.shipped = batch.seq
+		if err != nil {
+			b.errSeq = batch.seq
+			b.err = err
+		}
+		close(b.shippedCh)
+		b.shippedCh = make(chan struct{})
+		b.mu.Unlock()
+	}
+}
+
+// flush hands off the current batch and waits until it and the ones before it have been shipped,
+// returning the error of the last failed one. It returns early if ctx expires, the batches keep
+// being shipped in background.
+func (b *batcher) flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from := b.shipped
+	b.handOff()
+	target := b.handedOff
+
+	for b.shipped < target {
+		shipped := b.shippedCh
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			b.mu.Lock()
+			return ctx.Err()
+		case <-shipped:
+		}
+
+		b.mu.Lock()
+	}
+
+	if b.errSeq > from {
+		return b.err
+	}
+
+	return nil
+}
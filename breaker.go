@@ -0,0 +1,119 @@
+package logpet
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when every endpoint has its circuit breaker open
+var ErrCircuitOpen = errors.New("circuit breaker open on every endpoint")
+
+// CircuitBreakerConfig controls when an endpoint stops being called after consecutive failures.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed sends opening the circuit.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open before a single probe is let through.
+	OpenTimeout time.Duration
+}
+
+// DefaultCircuitBreakerConfig returns the circuit breaker configuration used by SetupDataDogLogger
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureThreshold: defaultBreakerFailureThreshold,
+		OpenTimeout:      defaultBreakerOpenTimeout,
+	}
+}
+
+// withDefaults returns a copy of the config with invalid values replaced by the defaults
+func (c CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = defaultBreakerFailureThreshold
+	}
+
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = defaultBreakerOpenTimeout
+	}
+
+	return c
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker tracks the consecutive failures of a single endpoint
+type circuitBreaker struct {
+	mu       sync.Mutex
+	config   CircuitBreakerConfig
+	state    breakerState
+	failures int
+	openedAt time.Time
+	// now returns the current time, replaced by the tests
+	now func() time.Time
+}
+
+func newCircuitBreaker(config CircuitBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{config: config, now: time.Now}
+}
+
+// allow reports whether the endpoint can be called. Once OpenTimeout has elapsed an open
+// breaker becomes half-open and lets a single probe through.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.config.OpenTimeout {
+			return false
+		}
+
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// a probe is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// success closes the breaker
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.mu.Unlock()
+}
+
+// failure records a failed call, opening the breaker when the threshold is reached or the probe failed
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.config.FailureThreshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// SetCircuitBreaker assign the provided circuit breaker configuration to the client,
+// invalid values fallback to the defaults and the state of every endpoint is reset
+func (l *StandardLogger) SetCircuitBreaker(config CircuitBreakerConfig) {
+	l.breakerConfig = config.withDefaults()
+	if l.ddSink != nil {
+		l.ddSink.resetBreakers()
+	}
+}
+
+// SetDataDogFallbackEndpoints sets the endpoints, in order, tried when the DataDog endpoint fails
+// or has its circuit breaker open
+func (l *StandardLogger) SetDataDogFallbackEndpoints(endpoints ...string) {
+	l.ddFallbackEndpoints = endpoints
+}
@@ -0,0 +1,139 @@
+package logpet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	now := time.Date(2020, 5, 4, 10, 0, 0, 0, time.UTC)
+
+	b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute})
+	b.now = func() time.Time { return now }
+
+	// a success resets the consecutive failures
+	b.failure()
+	b.failure()
+	b.success()
+	b.failure()
+	b.failure()
+	if !b.allow() {
+		t.Fatal("the breaker opened before 3 consecutive failures")
+	}
+
+	b.failure()
+	if b.allow() {
+		t.Fatal("the breaker is closed after 3 consecutive failures")
+	}
+
+	now = now.Add(59 * time.Second)
+	if b.allow() {
+		t.Fatal("the breaker let a call through before the open timeout")
+	}
+
+	now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatal("the breaker didn't let the probe through after the open timeout")
+	}
+
+	if b.allow() {
+		t.Fatal("the half-open breaker let a second call through")
+	}
+
+	// the failed probe opens the breaker again for another timeout
+	b.failure()
+	if b.allow() {
+		t.Fatal("the breaker is closed after the failed probe")
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("the breaker didn't let the second probe through")
+	}
+
+	b.success()
+	if !b.allow() || !b.allow() {
+		t.Fatal("the breaker isn't closed after the successful probe")
+	}
+}
+
+func TestDataDogFailsOverToFallbackEndpoint(t *testing.T) {
+	var primaryRequests, fallbackRequests int64
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&primaryRequests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&fallbackRequests, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer fallback.Close()
+
+	l := NewLogger()
+	l.SetBatchConfig(BatchConfig{MaxEntries: 1})
+	l.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+	l.SetCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Hour})
+	if err := l.SetupDataDogLogger(primary.URL, "api-key", "", false, false); err != nil {
+		t.Fatal(err)
+	}
+	l.SetDataDogFallbackEndpoints(fallback.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 4; i++ {
+		l.SendErrLog("failing over", nil)
+		if err := l.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the primary endpoint is skipped once its breaker is open
+	if requests := atomic.LoadInt64(&primaryRequests); requests != 2 {
+		t.Errorf("the primary endpoint received %d requests, want 2", requests)
+	}
+
+	if requests := atomic.LoadInt64(&fallbackRequests); requests != 4 {
+		t.Errorf("the fallback endpoint received %d requests, want 4", requests)
+	}
+
+	if sent := l.Stats().Sent; sent != 4 {
+		t.Errorf("sent %d logs, want 4", sent)
+	}
+}
+
+func TestDataDogReturnsCircuitOpenWhenEveryEndpointIsOpen(t *testing.T) {
+	intake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer intake.Close()
+
+	l := NewLogger()
+	l.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+	l.SetCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Hour})
+	if err := l.SetupDataDogLogger(intake.URL, "api-key", "", false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := l.ddSink.post(ctx, [][]byte{[]byte(`{}`)}); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("the first post returned %v, want the intake error", err)
+	}
+
+	err := l.ddSink.post(ctx, [][]byte{[]byte(`{}`)})
+	if err != ErrCircuitOpen {
+		t.Fatalf("post returned %v, want ErrCircuitOpen", err)
+	}
+
+	// the logs are saved offline and sent again later
+	if !isRetryable(err) {
+		t.Error("ErrCircuitOpen isn't retryable")
+	}
+}
@@ -1,19 +1,26 @@
 package logpet
 
+import "github.com/sirupsen/logrus"
+
 // ====================================
 //
 // Warning Logs Messages
 //
 //====================================
 
-// HTTPClientUnauthorized prints the string "I’m trying to connect to %s but I’m unauthorized." with a Warning error.
+// HTTPClientUnauthorized sends the string "I’m trying to connect to %s but I’m unauthorized." with a Warning error.
 // It accepts a string representing the server to which we made the request.
 func (l *StandardLogger) HTTPClientUnauthorized(server string) {
-	l.AddCustomFields().Warningf(clientStatusUnauthorized, server)
+	l.sendEvent(logrus.WarnLevel, EventHTTPClientUnauthorized, map[string]interface{}{
+		HTTPServerField: server,
+	}, clientStatusUnauthorized, server)
 }
 
-// HTTPClientInvalidBody prints the string "I sent %s to %s but he can’t read it" with a Warning error.
+// HTTPClientInvalidBody sends the string "I sent %s to %s but he can’t read it" with a Warning error.
 // It accepts two strings: the body of the request and the server to which we made the request.
 func (l *StandardLogger) HTTPClientInvalidBody(body, server string) {
-	l.AddCustomFields().Warningf(clientBodyInvalid, body, server)
+	l.sendEvent(logrus.WarnLevel, EventHTTPClientInvalidBody, map[string]interface{}{
+		HTTPBodyField:   body,
+		HTTPServerField: server,
+	}, clientBodyInvalid, body, server)
 }
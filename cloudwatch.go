@@ -0,0 +1,273 @@
+package logpet
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Units of the metrics recorded for CloudWatch
+const (
+	cloudWatchUnitCount        = "Count"
+	cloudWatchUnitMilliseconds = "Milliseconds"
+)
+
+// CloudWatchConfig configures the CloudWatch output used in AWS Lambda.
+type CloudWatchConfig struct {
+	// EnableMetrics writes the counters and timings recorded with IncrementCounter and RecordTiming
+	// as Embedded Metric Format documents when the logger is flushed.
+	EnableMetrics bool
+	// Namespace of the metrics, defaults to the service name or logpet.
+	Namespace string
+	// Dimensions are added to every metric, defaults to FunctionName when running in Lambda.
+	Dimensions map[string]string
+}
+
+// CloudWatchFormatter encodes entries as single-line JSON with the timestamp, level and message
+// keys used by the Lambda JSON log format, so they can be queried with CloudWatch Logs Insights.
+type CloudWatchFormatter struct{}
+
+// Format encodes the entry, the hostname and the DataDog specific attributes are omitted
+func (f *CloudWatchFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(map[string]interface{}, len(entry.Data)+3)
+	for key, value := range entry.Data {
+		if serviceMetadataFields[key] && key != "service" {
+			continue
+		}
+
+		data[key] = normalizeValue(value)
+	}
+
+	data["timestamp"] = entry.Time.UTC().Format(time.RFC3339Nano)
+	data["level"] = strings.ToUpper(levelName(entry.Level))
+	data["message"] = entry.Message
+
+	line, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(line, '\n'), nil
+}
+
+// cloudWatchMetrics aggregates the metrics recorded between two flushes
+type cloudWatchMetrics struct {
+	mu         sync.Mutex
+	config     CloudWatchConfig
+	dimensions map[string]*cloudWatchDimensionSet
+}
+
+// cloudWatchDimensionSet holds the metrics sharing the same dimensions
+type cloudWatchDimensionSet struct {
+	dimensions map[string]string
+	metrics    map[string]*cloudWatchMetric
+}
+
+type cloudWatchMetric struct {
+	unit   string
+	values []float64
+}
+
+// EnableCloudWatchOutput switches to local mode writing single-line JSON to the stdout, where the
+// Lambda runtime collects it for CloudWatch. SetupDataDogLogger keeps local mode enabled afterwards.
+// In Lambda the logger must be flushed before the end of every invocation.
+func (l *StandardLogger) EnableCloudWatchOutput(config CloudWatchConfig) {
+	if config.Namespace == "" {
+		config.Namespace = l.serviceInfo.Service
+	}
+
+	if config.Namespace == "" {
+		config.Namespace = defaultCloudWatchNamespace
+	}
+
+	if config.Dimensions == nil && os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		config.Dimensions = map[string]string{"FunctionName": os.Getenv("AWS_LAMBDA_FUNCTION_NAME")}
+	}
+
+	l.cloudWatch = &cloudWatchMetrics{
+		config:     config,
+		dimensions: make(map[string]*cloudWatchDimensionSet),
+	}
+
+	l.SetLocalFormatter(&CloudWatchFormatter{})
+	l.EnableLocalMode(true)
+}
+
+// IncrementCounter adds value to the counter with the provided name and dimensions,
+// it does nothing unless CloudWatch metrics are enabled
+func (l *StandardLogger) IncrementCounter(name string, value float64, dimensions map[string]string) {
+	if l.cloudWatch == nil || !l.cloudWatch.config.EnableMetrics {
+		return
+	}
+
+	l.cloudWatch.record(name, cloudWatchUnitCount, value, dimensions, true)
+}
+
+// RecordTiming records a duration, in milliseconds, of the timing with the provided name and dimensions,
+// it does nothing unless CloudWatch metrics are enabled
+func (l *StandardLogger) RecordTiming(name string, duration time.Duration, dimensions map[string]string) {
+	if l.cloudWatch == nil || !l.cloudWatch.config.EnableMetrics {
+		return
+	}
+
+	milliseconds := float64(duration) / float64(time.Millisecond)
+	l.cloudWatch.record(name, cloudWatchUnitMilliseconds, milliseconds, dimensions, false)
+}
+
+// record adds the value to the metric, counters are summed while every timing value is kept
+func (m *cloudWatchMetrics) record(name, unit string, value float64, dimensions map[string]string, sum bool) {
+	merged := make(map[string]string, len(m.config.Dimensions)+len(dimensions))
+	for key, dimension := range m.config.Dimensions {
+		merged[key] = dimension
+	}
+	for key, dimension := range dimensions {
+		merged[key] = dimension
+	}
+
+	key := dimensionsKey(merged)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	set, ok := m.dimensions[key]
+	if !ok {
+		set = &cloudWatchDimensionSet{dimensions: merged, metrics: make(map[string]*cloudWatchMetric)}
+		m.dimensions[key] = set
+	}
+
+	metric, ok := set.metrics[name]
+	if !ok {
+		metric = &cloudWatchMetric{unit: unit}
+		set.metrics[name] = metric
+	}
+
+	if sum && len(metric.values) > 0 {
+		metric.values[0] += value
+		return
+	}
+
+	metric.values = append(metric.values, value)
+}
+
+// documents returns the EMF documents of the recorded metrics and resets them.
+// A document holds up to 100 metrics with up to 100 values each, the remaining ones
+// are moved to the following documents, and up to 30 dimensions.
+func (m *cloudWatchMetrics) documents() [][]byte {
+	m.mu.Lock()
+	sets := m.dimensions
+	m.dimensions = make(map[string]*cloudWatchDimensionSet)
+	m.mu.Unlock()
+
+	keys := make([]string, 0, len(sets))
+	for key := range sets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+
+	var documents [][]byte
+	for _, key := range keys {
+		set := sets[key]
+
+		dimensionNames := make([]string, 0, len(set.dimensions))
+		for name := range set.dimensions {
+			dimensionNames = append(dimensionNames, name)
+		}
+		sort.Strings(dimensionNames)
+
+		// a dimension set holds up to 30 dimensions, the other ones are just properties of the document
+		if len(dimensionNames) > cloudWatchMaxDimensions {
+			dimensionNames = dimensionNames[:cloudWatchMaxDimensions]
+		}
+
+		names := make([]string, 0, len(set.metrics))
+		for name := range set.metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for len(names) > 0 {
+			document := make(map[string]interface{}, len(set.dimensions)+len(names)+1)
+			for name, value := range set.dimensions {
+				document[name] = value
+			}
+
+			var definitions []map[string]string
+			var remaining []string
+
+			for _, name := range names {
+				metric := set.metrics[name]
+
+				if len(definitions) == cloudWatchMaxMetrics {
+					remaining = append(remaining, name)
+					continue
+				}
+
+				values := metric.values
+				if len(values) > cloudWatchMaxValues {
+					values = values[:cloudWatchMaxValues]
+					remaining = append(remaining, name)
+				}
+				metric.values = metric.values[len(values):]
+
+				definitions = append(definitions, map[string]string{"Name": name, "Unit": metric.unit})
+				if len(values) == 1 {
+					document[name] = values[0]
+				} else {
+					document[name] = values
+				}
+			}
+
+			document["_aws"] = map[string]interface{}{
+				"Timestamp": timestamp,
+				"CloudWatchMetrics": []map[string]interface{}{{
+					"Namespace":  m.config.Namespace,
+					"Dimensions": [][]string{dimensionNames},
+					"Metrics":    definitions,
+				}},
+			}
+
+			encoded, err := json.Marshal(document)
+			if err == nil {
+				documents = append(documents, encoded)
+			}
+
+			names = remaining
+		}
+	}
+
+	return documents
+}
+
+// flushCloudWatchMetrics writes the recorded metrics with the local mode sink
+func (l *StandardLogger) flushCloudWatchMetrics() error {
+	if l.cloudWatch == nil || l.localRoute == nil {
+		return nil
+	}
+
+	var firstErr error
+	for _, document := range l.cloudWatch.documents() {
+		if err := l.localRoute.sink.Write(nil, document); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// dimensionsKey returns the dimensions sorted by name as a string identifying the set
+func dimensionsKey(dimensions map[string]string) string {
+	pairs := make([]string, 0, len(dimensions))
+	for name, value := range dimensions {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "\x00")
+}
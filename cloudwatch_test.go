@@ -0,0 +1,117 @@
+package logpet
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCloudWatchDocumentsSplitMetrics(t *testing.T) {
+	dimensions := make(map[string]string)
+	for i := 0; i < 35; i++ {
+		dimensions[fmt.Sprintf("dimension%02d", i)] = "value"
+	}
+
+	l := NewLogger()
+	l.EnableCloudWatchOutput(CloudWatchConfig{EnableMetrics: true, Namespace: "app", Dimensions: dimensions})
+
+	for i := 0; i < 250; i++ {
+		name := fmt.Sprintf("counter%03d", i)
+		l.IncrementCounter(name, 1, nil)
+		l.IncrementCounter(name, 2, nil)
+	}
+
+	// sorted first, its values don't fit a document
+	for i := 0; i < 150; i++ {
+		l.RecordTiming("a.timing", time.Duration(i)*time.Millisecond, nil)
+	}
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	documents := l.cloudWatch.documents()
+	after := time.Now().UnixNano() / int64(time.Millisecond)
+
+	// 251 metrics plus the timing values left from the first document
+	if len(documents) != 3 {
+		t.Fatalf("got %d documents, want 3", len(documents))
+	}
+
+	timings := 0
+	counters := make(map[string]bool)
+
+	for i, encoded := range documents {
+		var document struct {
+			AWS struct {
+				Timestamp         int64
+				CloudWatchMetrics []struct {
+					Namespace  string
+					Dimensions [][]string
+					Metrics    []struct{ Name, Unit string }
+				}
+			} `json:"_aws"`
+		}
+
+		if err := json.Unmarshal(encoded, &document); err != nil {
+			t.Fatal(err)
+		}
+
+		if document.AWS.Timestamp < before || document.AWS.Timestamp > after {
+			t.Errorf("document %d has the timestamp %d, want milliseconds between %d and %d", i, document.AWS.Timestamp, before, after)
+		}
+
+		if len(document.AWS.CloudWatchMetrics) != 1 {
+			t.Fatalf("document %d has %d metric directives, want 1", i, len(document.AWS.CloudWatchMetrics))
+		}
+
+		directive := document.AWS.CloudWatchMetrics[0]
+
+		if directive.Namespace != "app" {
+			t.Errorf("document %d has the namespace %q", i, directive.Namespace)
+		}
+
+		if len(directive.Dimensions) != 1 || len(directive.Dimensions[0]) != cloudWatchMaxDimensions {
+			t.Errorf("document %d has the dimension sets %v, want one of 30 dimensions", i, directive.Dimensions)
+		}
+
+		if want := []int{100, 100, 52}[i]; len(directive.Metrics) != want {
+			t.Errorf("document %d has %d metrics, want %d", i, len(directive.Metrics), want)
+		}
+
+		var values map[string]interface{}
+		if err := json.Unmarshal(encoded, &values); err != nil {
+			t.Fatal(err)
+		}
+
+		// the dimensions left out of the set are kept as properties
+		if values["dimension34"] != "value" {
+			t.Errorf("document %d doesn't hold the dimension34 property", i)
+		}
+
+		for _, metric := range directive.Metrics {
+			if metric.Name == "a.timing" {
+				if metric.Unit != cloudWatchUnitMilliseconds {
+					t.Errorf("the timing unit is %q", metric.Unit)
+				}
+				timings += len(values[metric.Name].([]interface{}))
+				continue
+			}
+
+			if values[metric.Name] != float64(3) || metric.Unit != cloudWatchUnitCount {
+				t.Errorf("the counter %s is %v %s, want 3 Count", metric.Name, values[metric.Name], metric.Unit)
+			}
+
+			if counters[metric.Name] {
+				t.Errorf("the counter %s is in more than one document", metric.Name)
+			}
+			counters[metric.Name] = true
+		}
+	}
+
+	if len(counters) != 250 || timings != 150 {
+		t.Errorf("the documents hold %d counters and %d timing values, want 250 and 150", len(counters), timings)
+	}
+
+	if documents := l.cloudWatch.documents(); len(documents) != 0 {
+		t.Errorf("got %d documents after the reset, want 0", len(documents))
+	}
+}
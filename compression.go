@@ -0,0 +1,129 @@
+package logpet
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Content encodings supported for outgoing payloads
+const (
+	CompressionNone    = ""
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate"
+)
+
+// Compression describes how outgoing payloads are encoded.
+// Level accepts the values of compress/flate, zero means flate.DefaultCompression.
+type Compression struct {
+	Encoding string
+	Level    int
+}
+
+// validate checks encoding and level returning an error if one of them is not supported
+func (c Compression) validate() error {
+	switch c.Encoding {
+	case CompressionNone, CompressionGzip, CompressionDeflate:
+	default:
+		return fmt.Errorf("unsupported content encoding %q", c.Encoding)
+	}
+
+	if c.Level < flate.HuffmanOnly || c.Level > flate.BestCompression {
+		return fmt.Errorf("invalid compression level %d", c.Level)
+	}
+
+	return nil
+}
+
+// compress returns the payload encoded with the configured encoding,
+// the payload is returned as is when compression is disabled.
+func (c Compression) compress(payload []byte) ([]byte, error) {
+	if c.Encoding == CompressionNone {
+		return payload, nil
+	}
+
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+		err error
+	)
+
+	// deflate as HTTP content encoding is the zlib format (RFC 1950)
+	switch c.Encoding {
+	case CompressionGzip:
+		w, err = gzip.NewWriterLevel(&buf, level)
+	case CompressionDeflate:
+		w, err = zlib.NewWriterLevel(&buf, level)
+	default:
+		err = fmt.Errorf("unsupported content encoding %q", c.Encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(payload); err != nil {
+		return nil, err
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SetCompression enables the compression of the payloads sent to DataDog with the provided
+// content encoding (CompressionGzip or CompressionDeflate) and level, CompressionNone disables it.
+func (l *StandardLogger) SetCompression(encoding string, level int) error {
+	compression := Compression{Encoding: encoding, Level: level}
+
+	if err := compression.validate(); err != nil {
+		return err
+	}
+
+	l.compression = compression
+
+	return nil
+}
+
+// snappyEncode returns src encoded in the snappy block format, as required by the Loki protobuf push API.
+// The data is stored as literals only, trading the compression ratio for a dependency free encoder.
+func snappyEncode(src []byte) []byte {
+	dst := make([]byte, 0, len(src)+len(src)/snappyMaxLiteralLength*5+binary.MaxVarintLen64)
+
+	var preamble [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(preamble[:], uint64(len(src)))
+	dst = append(dst, preamble[:n]...)
+
+	for len(src) > 0 {
+		literal := src
+		if len(literal) > snappyMaxLiteralLength {
+			literal = literal[:snappyMaxLiteralLength]
+		}
+		src = src[len(literal):]
+
+		// the tag holds the length minus one, inline when smaller than 60 or in the following bytes
+		length := len(literal) - 1
+		switch {
+		case length < 60:
+			dst = append(dst, byte(length)<<2)
+		case length < 1<<8:
+			dst = append(dst, 60<<2, byte(length))
+		default:
+			dst = append(dst, 61<<2, byte(length), byte(length>>8))
+		}
+
+		dst = append(dst, literal...)
+	}
+
+	return dst
+}
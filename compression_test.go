@@ -0,0 +1,130 @@
+package logpet
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport counts the requests sent through the custom http client
+type countingTransport struct {
+	requests int64
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestCompressedPayloadsDecodedByIntake(t *testing.T) {
+	for _, encoding := range []string{CompressionGzip, CompressionDeflate} {
+		t.Run(encoding, func(t *testing.T) {
+			var mu sync.Mutex
+			var messages []string
+			var contentEncoding string
+
+			intake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body io.ReadCloser
+				var err error
+
+				switch r.Header.Get("Content-Encoding") {
+				case CompressionGzip:
+					body, err = gzip.NewReader(r.Body)
+				case CompressionDeflate:
+					body, err = zlib.NewReader(r.Body)
+				default:
+					body = r.Body
+				}
+				if err != nil {
+					t.Errorf("unable to read the %s body, %v", r.Header.Get("Content-Encoding"), err)
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				data, err := ioutil.ReadAll(body)
+				if err != nil {
+					t.Errorf("unable to decompress the body, %v", err)
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				var logs []map[string]interface{}
+				if err := json.Unmarshal(data, &logs); err != nil {
+					t.Errorf("unable to decode the decompressed body %q, %v", data, err)
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				mu.Lock()
+				contentEncoding = r.Header.Get("Content-Encoding")
+				for _, log := range logs {
+					messages = append(messages, log["message"].(string))
+				}
+				mu.Unlock()
+
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer intake.Close()
+
+			l := NewLogger()
+			if err := l.SetupDataDogLogger(intake.URL, "api-key", "", false, false); err != nil {
+				t.Fatal(err)
+			}
+
+			transport := &countingTransport{}
+			if err := l.SetUpCustomHTTPClient(&http.Client{Transport: transport, Timeout: 5 * time.Second}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := l.SetCompression(encoding, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			l.SendInfoLog("first", nil)
+			l.SendErrLog("second", nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := l.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if contentEncoding != encoding {
+				t.Errorf("Content-Encoding is %q, want %q", contentEncoding, encoding)
+			}
+
+			if len(messages) != 2 || messages[0] != "first" || messages[1] != "second" {
+				t.Errorf("intake decoded %v, want [first second]", messages)
+			}
+
+			if atomic.LoadInt64(&transport.requests) == 0 {
+				t.Error("the custom http client was not used")
+			}
+		})
+	}
+}
+
+func TestCompressionRejectsInvalidSettings(t *testing.T) {
+	l := NewLogger()
+
+	if err := l.SetCompression("br", 0); err == nil {
+		t.Error("unsupported encoding accepted")
+	}
+
+	if err := l.SetCompression(CompressionGzip, 42); err == nil {
+		t.Error("invalid level accepted")
+	}
+}
@@ -0,0 +1,208 @@
+package logpet
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// netSender writes messages on a UDP, TCP or TLS connection, used by the syslog and GELF sinks.
+// The connection is opened by the first send.
+type netSender struct {
+	mu        sync.Mutex
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	conn      net.Conn
+}
+
+// newNetSender returns a sender for the address without connecting, network is udp, tcp or tls
+func newNetSender(network, address string, tlsConfig *tls.Config, timeout time.Duration) *netSender {
+	return &netSender{
+		network:   network,
+		address:   address,
+		tlsConfig: tlsConfig,
+		timeout:   timeout,
+	}
+}
+
+// dial opens the connection
+func (s *netSender) dial() error {
+	dialer := &net.Dialer{Timeout: s.timeout}
+
+	var conn net.Conn
+	var err error
+
+	if s.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(s.network, s.address)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to connect to %s %s, %v", s.network, s.address, err)
+	}
+
+	s.conn = conn
+
+	return nil
+}
+
+// send writes every message with its own write, so each one is a datagram on UDP.
+// It connects if not connected yet, a stream connection is dialed again once if a write fails.
+func (s *netSender) send(messages ...[]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+
+	err := s.write(messages)
+	if err != nil && s.network != "udp" {
+		_ = s.conn.Close()
+		s.conn = nil
+		if err = s.dial(); err == nil {
+			err = s.write(messages)
+		}
+	}
+
+	return err
+}
+
+func (s *netSender) write(messages [][]byte) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.timeout)); err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if _, err := s.conn.Write(message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close closes the connection, if any
+func (s *netSender) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+// batchedNetSink is embedded by the syslog and GELF sinks: it batches the encoded messages and
+// writes them from the shipping goroutine of the batcher, so the listener never waits for the network
+type batchedNetSink struct {
+	sender  *netSender
+	batcher *batcher
+	cancel  context.CancelFunc
+	metrics *pipelineMetrics
+	// packets returns the writes of a message, the message itself if nil
+	packets func(message []byte) ([][]byte, error)
+}
+
+func newBatchedNetSink(sender *netSender, packets func(message []byte) ([][]byte, error)) batchedNetSink {
+	return batchedNetSink{
+		sender:  sender,
+		metrics: &pipelineMetrics{},
+		packets: packets,
+	}
+}
+
+// start creates the batcher writing the messages
+func (s *batchedNetSink) start(config BatchConfig) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.cancel = cancel
+	s.batcher = newBatcher(config.withDefaults(), ctx, s.send, s.dropBacklog)
+}
+
+func (s *batchedNetSink) attach(l *StandardLogger) {
+	s.metrics = &l.metrics
+}
+
+// send writes the messages of a batch, the whole batch fails if the writes fail while
+// a message whose packets can't be built is the only one lost
+func (s *batchedNetSink) send(ctx context.Context, batch [][]byte) error {
+	if err := ctx.Err(); err != nil {
+		s.fail(len(batch))
+		return err
+	}
+
+	var packetsErr error
+	sent, size := 0, 0
+	writes := make([][]byte, 0, len(batch))
+
+	for _, message := range batch {
+		packets := [][]byte{message}
+		if s.packets != nil {
+			var err error
+			if packets, err = s.packets(message); err != nil {
+				s.fail(1)
+				packetsErr = err
+				continue
+			}
+		}
+
+		writes = append(writes, packets...)
+		sent++
+		size += len(message)
+	}
+
+	if sent == 0 {
+		return packetsErr
+	}
+
+	if err := s.sender.send(writes...); err != nil {
+		s.fail(sent)
+		return err
+	}
+
+	s.metrics.recordSent(sent, size)
+
+	return packetsErr
+}
+
+// fail counts messages that couldn't be written
+func (s *batchedNetSink) fail(messages int) {
+	atomic.AddInt64(&s.metrics.failed, int64(messages))
+	atomic.AddInt64(&s.metrics.droppedSendFailed, int64(messages))
+}
+
+// dropBacklog counts the messages of a batch dropped because too many batches were waiting to be written
+func (s *batchedNetSink) dropBacklog(batch [][]byte) {
+	atomic.AddInt64(&s.metrics.droppedBacklog, int64(len(batch)))
+}
+
+// Flush writes the current batch, returning early if ctx expires
+func (s *batchedNetSink) Flush(ctx context.Context) error {
+	return s.batcher.flush(ctx)
+}
+
+// Close writes the current batch and closes the connection
+func (s *batchedNetSink) Close(ctx context.Context) error {
+	err := s.Flush(ctx)
+	s.cancel()
+
+	if closeErr := s.sender.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,203 @@
+package logpet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ANSI colors of the console levels
+const (
+	colorRed     = 31
+	colorYellow  = 33
+	colorBlue    = 36
+	colorGray    = 90
+	colorMagenta = 35
+)
+
+// ConsoleFormatter formats entries for humans: timestamp, colored level, message and the
+// fields as key=value pairs sorted by key. Multi-line field values, like stack traces, follow
+// on their own lines. Colors are used only when the stdout is a terminal, unless forced.
+type ConsoleFormatter struct {
+	// TimestampFormat defaults to a time of day with milliseconds.
+	TimestampFormat string
+	// ForceColors prints ANSI colors even if the stdout isn't a terminal.
+	ForceColors bool
+	// DisableColors prints the level without ANSI colors, it wins over ForceColors.
+	DisableColors bool
+}
+
+// colors reports whether the level and the keys are colored
+func (f *ConsoleFormatter) colors() bool {
+	if f.DisableColors {
+		return false
+	}
+
+	return f.ForceColors || stdoutIsTerminal()
+}
+
+// Format renders a single entry
+func (f *ConsoleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = defaultConsoleTimestampFormat
+	}
+
+	colors := f.colors()
+
+	var b bytes.Buffer
+
+	b.WriteString(entry.Time.Format(timestampFormat))
+	b.WriteByte(' ')
+
+	level := fmt.Sprintf("%-5s", strings.ToUpper(levelName(entry.Level)))
+	if colors {
+		fmt.Fprintf(&b, "\x1b[%dm%s\x1b[0m", levelColor(entry.Level), level)
+	} else {
+		b.WriteString(level)
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(entry.Message)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		if !serviceMetadataFields[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var blocks []string
+	for _, key := range keys {
+		value := consoleValue(entry.Data[key])
+
+		if strings.Contains(value, "\n") {
+			blocks = append(blocks, key, value)
+			continue
+		}
+
+		b.WriteString("  ")
+		if colors {
+			fmt.Fprintf(&b, "\x1b[%dm%s\x1b[0m=%s", colorGray, key, value)
+		} else {
+			fmt.Fprintf(&b, "%s=%s", key, value)
+		}
+	}
+
+	b.WriteByte('\n')
+
+	for i := 0; i < len(blocks); i += 2 {
+		fmt.Fprintf(&b, "    %s:\n", blocks[i])
+		for _, line := range strings.Split(strings.TrimRight(blocks[i+1], "\n"), "\n") {
+			b.WriteString("        ")
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// consoleValue renders a field value, quoting strings with spaces and encoding maps and slices as JSON
+func consoleValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if strings.Contains(v, "\n") {
+			return v
+		}
+		if v == "" || strings.ContainsAny(v, " =\"\t") {
+			return strconv.Quote(v)
+		}
+		return v
+	case error:
+		return consoleValue(v.Error())
+	case fmt.Stringer:
+		return consoleValue(v.String())
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		return fmt.Sprint(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return consoleValue(fmt.Sprintf("%+v", v))
+		}
+		return string(encoded)
+	}
+}
+
+// levelName returns the level name, shortening warning to warn
+func levelName(level logrus.Level) string {
+	if level == logrus.WarnLevel {
+		return "warn"
+	}
+
+	return level.String()
+}
+
+// levelColor returns the ANSI color of the level
+func levelColor(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return colorMagenta
+	case logrus.ErrorLevel:
+		return colorRed
+	case logrus.WarnLevel:
+		return colorYellow
+	case logrus.InfoLevel:
+		return colorBlue
+	default:
+		return colorGray
+	}
+}
+
+// isTerminal reports whether the file is a character device, like an interactive terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+var stdoutTerminalOnce sync.Once
+var stdoutTerminal bool
+
+// stdoutIsTerminal reports whether the stdout is a terminal, checked once. Replaced by the tests.
+var stdoutIsTerminal = func() bool {
+	stdoutTerminalOnce.Do(func() {
+		stdoutTerminal = isTerminal(os.Stdout)
+	})
+
+	return stdoutTerminal
+}
+
+// defaultLocalFormatter returns the console formatter when the stdout is a terminal, nil
+// otherwise so the JSON formatter of the logger is used when the output is piped
+func defaultLocalFormatter() logrus.Formatter {
+	if stdoutIsTerminal() {
+		return &ConsoleFormatter{}
+	}
+
+	return nil
+}
+
+// SetLocalFormatter sets the formatter of the logs printed in local mode, nil uses the
+// formatter of the logger. The default is the console formatter on a terminal and JSON otherwise.
+func (l *StandardLogger) SetLocalFormatter(formatter logrus.Formatter) {
+	l.sinksMu.Lock()
+	defer l.sinksMu.Unlock()
+
+	l.localFormatter = formatter
+	l.localFormatterSet = true
+	if l.localRoute != nil {
+		l.localRoute.formatter = formatter
+	}
+}
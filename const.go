@@ -1,5 +1,7 @@
 package logpet
 
+import "time"
+
 // ====================================
 //
 // Info Logs Messages
@@ -43,4 +45,193 @@ const (
 	missingEntity           = "Can't get: %s"
 )
 
-const DataDogDefaultEndpoint = "https://http-intake.logs.datadoghq.com/v1/input"
+// Event codes of the predefined messages, sent with the EventCodeField attribute
+const (
+	EventHTTPServerStarted           = "HTTP_SERVER_STARTED"
+	EventHTTPServerUnauthorized      = "HTTP_SERVER_UNAUTHORIZED"
+	EventHTTPServerInvalidBody       = "HTTP_SERVER_INVALID_BODY"
+	EventHTTPServerSendResponseError = "HTTP_SERVER_SEND_RESPONSE_ERROR"
+	EventHTTPServerStartingError     = "HTTP_SERVER_STARTING_ERROR"
+	EventHTTPClientUnauthorized      = "HTTP_CLIENT_UNAUTHORIZED"
+	EventHTTPClientInvalidBody       = "HTTP_CLIENT_INVALID_BODY"
+	EventDatabaseAddError            = "DATABASE_ADD_ERROR"
+	EventDatabaseGetError            = "DATABASE_GET_ERROR"
+	EventDatabaseConnectionError     = "DATABASE_CONNECTION_ERROR"
+	EventMissingEnvVariable          = "MISSING_ENV_VARIABLE"
+	EventMissingEntity               = "MISSING_ENTITY"
+)
+
+// Attributes of the predefined messages
+const (
+	EventCodeField    = "event.code"
+	HTTPPortField     = "http.port"
+	HTTPClientField   = "http.client"
+	HTTPResourceField = "http.resource"
+	HTTPServerField   = "http.server"
+	HTTPBodyField     = "http.body"
+	ErrorMessageField = "error.message"
+	EntityNameField   = "entity.name"
+	UserNameField     = "user.name"
+	DatabaseHostField = "db.host"
+	EnvVariableField  = "env.variable"
+)
+
+// Attributes of the request logs built by the AWS Lambda and gin helpers
+const (
+	HTTPMethodField          = "http.method"
+	HTTPURLField             = "http.url"
+	HTTPHeadersField         = "http.headers"
+	HTTPQueryParametersField = "http.query_parameters"
+	HTTPPathParametersField  = "http.path_parameters"
+)
+
+const DataDogDefaultEndpoint = "https://http-intake.logs.datadoghq.com/api/v2/logs"
+
+// dataDogSiteEndpointFormat builds the logs intake URL from the site domain
+const dataDogSiteEndpointFormat = "https://http-intake.logs.%s/api/v2/logs"
+
+// dataDogSites maps the short name of every DataDog site to its domain
+var dataDogSites = map[string]string{
+	"us1": "datadoghq.com",
+	"eu":  "datadoghq.eu",
+	"us3": "us3.datadoghq.com",
+	"us5": "us5.datadoghq.com",
+	"ap1": "ap1.datadoghq.com",
+	"gov": "ddog-gov.com",
+}
+
+// Limits of the DataDog v2 logs intake
+const (
+	DataDogMaxBatchEntries = 1000
+	DataDogMaxBatchBytes   = 5 * 1024 * 1024
+	// DataDogMaxLogAge is how old the timestamp of a log can be, older logs are rejected by the intake
+	DataDogMaxLogAge = 18 * time.Hour
+)
+
+const defaultBatchLinger = 2 * time.Second
+
+// defaultBatchMaxPending is the number of batches waiting to be shipped before the oldest one is dropped
+const defaultBatchMaxPending = 16
+
+// Defaults of the retry policy
+const (
+	defaultRetryMaxAttempts    = 5
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = 30 * time.Second
+	defaultRetryMultiplier     = 2
+	defaultRetryJitter         = 0.2
+	defaultRetryAttemptTimeout = 10 * time.Second
+
+	// maxRetryAfter caps the wait requested by an intake with the Retry-After header
+	maxRetryAfter = 2 * time.Minute
+
+	// maxDrainedResponseBytes is the maximum number of bytes read from a response body before closing it
+	maxDrainedResponseBytes = 64 * 1024
+)
+
+// Defaults of the circuit breaker
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenTimeout      = 30 * time.Second
+)
+
+// defaultDedupWindow is the window used when DedupConfig doesn't specify one
+const defaultDedupWindow = time.Minute
+
+// defaultFatalFlushTimeout is how long a fatal log waits for the queued logs to be shipped
+const defaultFatalFlushTimeout = 5 * time.Second
+
+// fatalSpoolTimeout is how long a fatal log waits for the logs not shipped in time to be saved offline
+const fatalSpoolTimeout = time.Second
+
+// defaultConsoleTimestampFormat is the timestamp format of the console formatter
+const defaultConsoleTimestampFormat = "15:04:05.000"
+
+// defaultQueueCapacity is the number of logs the queue holds before applying the overflow policy
+const defaultQueueCapacity = 10000
+
+// flushPollInterval is how often Flush checks whether the queued logs have been handled
+const flushPollInterval = 10 * time.Millisecond
+
+// defaultHTTPTimeout is the timeout of the http client created by SetupDataDogLogger
+const defaultHTTPTimeout = 30 * time.Second
+
+// defaultOTLPEndpoint is the logs endpoint of a local OpenTelemetry collector
+const defaultOTLPEndpoint = "http://localhost:4318/v1/logs"
+
+// otlpScopeNameValue is the instrumentation scope name of the OTLP log records
+const otlpScopeNameValue = "logpet"
+
+// defaultSyslogStructuredDataID is the SD-ID of the syslog element holding the custom fields,
+// 32473 is the private enterprise number reserved for documentation by RFC 5612
+const defaultSyslogStructuredDataID = "logpet@32473"
+
+// syslogTimestampFormat is the RFC 3339 timestamp with microseconds used by RFC 5424
+const syslogTimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// syslogRFC3164TimestampFormat is the local time without year used by RFC 3164
+const syslogRFC3164TimestampFormat = "Jan _2 15:04:05"
+
+// defaultLokiEndpoint is the push API of a local Loki
+const defaultLokiEndpoint = "http://localhost:3100/loki/api/v1/push"
+
+// snappyMaxLiteralLength is the size of the literals written by the snappy encoder
+const snappyMaxLiteralLength = 1 << 16
+
+// Defaults of the Elasticsearch sink
+const (
+	defaultElasticsearchEndpoint = "http://localhost:9200"
+	defaultElasticsearchIndex    = "logpet-{2006.01.02}"
+)
+
+// Defaults of the Splunk HTTP Event Collector sink
+const (
+	defaultSplunkEndpoint        = "https://localhost:8088/services/collector/event"
+	defaultSplunkSource          = "logpet"
+	defaultSplunkSourcetype      = "_json"
+	defaultSplunkAckTimeout      = time.Minute
+	defaultSplunkAckPollInterval = time.Second
+)
+
+// defaultCloudWatchNamespace is the namespace of the CloudWatch metrics when no service name is set
+const defaultCloudWatchNamespace = "logpet"
+
+// Limits of an Embedded Metric Format document
+const (
+	cloudWatchMaxMetrics    = 100
+	cloudWatchMaxValues     = 100
+	cloudWatchMaxDimensions = 30
+)
+
+// Chunking of the GELF UDP messages
+const (
+	// defaultGELFChunkSize fits a datagram in the MTU of most networks
+	defaultGELFChunkSize = 1420
+	gelfChunkHeaderSize  = 12
+	gelfMaxChunks        = 128
+)
+
+// Elastic Common Schema version and timestamp format of the ECS formatter
+const (
+	ecsVersion         = "8.11.0"
+	ecsTimestampFormat = "2006-01-02T15:04:05.000Z07:00"
+	// ecsErrorCauseField holds the logrus error of the entries with ErrorMessageField too
+	ecsErrorCauseField = "error.cause"
+)
+
+// Defaults of the offline logs spool
+const (
+	defaultSpoolMaxSegmentBytes = 8 << 20
+	defaultSpoolMaxSegmentAge   = time.Hour
+	defaultSpoolMaxTotalBytes   = 256 << 20
+)
+
+// Naming of the offline logs segments, the sequence number keeps them sorted by age
+const (
+	spoolSegmentPrefix = "segment-"
+	spoolSegmentSuffix = ".ndjson"
+	spoolSegmentFormat = spoolSegmentPrefix + "%020d" + spoolSegmentSuffix
+)
+
+// elasticsearchSpoolDir is the directory of the Elasticsearch offline documents in the offline logs path
+const elasticsearchSpoolDir = "elasticsearch"
@@ -0,0 +1,105 @@
+package logpet
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Attributes set by the context helpers
+const (
+	RequestIDField = "http.request_id"
+	TraceIDField   = "dd.trace_id"
+	SpanIDField    = "dd.span_id"
+)
+
+type contextFieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying the provided fields along with the ones already
+// attached to ctx, the provided ones win on conflicts
+func ContextWithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	merged := copyFields(FieldsFromContext(ctx))
+	for key, value := range fields {
+		merged[key] = value
+	}
+
+	return context.WithValue(ctx, contextFieldsKey{}, merged)
+}
+
+// ContextWithField returns a copy of ctx carrying the provided field along with the ones already attached to ctx
+func ContextWithField(ctx context.Context, key string, value interface{}) context.Context {
+	return ContextWithFields(ctx, map[string]interface{}{key: value})
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return ContextWithField(ctx, RequestIDField, requestID)
+}
+
+// ContextWithUser returns a copy of ctx carrying the user name
+func ContextWithUser(ctx context.Context, user string) context.Context {
+	return ContextWithField(ctx, UserNameField, user)
+}
+
+// ContextWithTrace returns a copy of ctx carrying the trace and span IDs used to correlate logs and traces
+func ContextWithTrace(ctx context.Context, traceID, spanID string) context.Context {
+	return ContextWithFields(ctx, map[string]interface{}{
+		TraceIDField: traceID,
+		SpanIDField:  spanID,
+	})
+}
+
+// FieldsFromContext returns the fields attached to ctx, the returned map must not be modified
+func FieldsFromContext(ctx context.Context) map[string]interface{} {
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(contextFieldsKey{}).(map[string]interface{})
+	return fields
+}
+
+// mergeContextFields returns the fields attached to ctx overridden by the call-site ones.
+// The global CustomFields have the lowest precedence and are added when the log is shipped.
+func mergeContextFields(ctx context.Context, customFields map[string]interface{}) map[string]interface{} {
+	ctxFields := FieldsFromContext(ctx)
+	if len(ctxFields) == 0 {
+		return customFields
+	}
+
+	merged := copyFields(ctxFields)
+	for key, value := range customFields {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// sendCtx sends a log to the log queue with the fields attached to ctx
+func (l *StandardLogger) sendCtx(ctx context.Context, level logrus.Level, message string, customFields map[string]interface{}) {
+	l.enqueue(Log{
+		Message:      message,
+		CustomFields: mergeContextFields(ctx, customFields),
+		Level:        level,
+	})
+}
+
+// InfoCtx sends a log with info level to the log queue including the fields attached to ctx
+func (l *StandardLogger) InfoCtx(ctx context.Context, message string, customFields map[string]interface{}) {
+	l.sendCtx(ctx, logrus.InfoLevel, message, customFields)
+}
+
+// WarnCtx sends a log with warning level to the log queue including the fields attached to ctx
+func (l *StandardLogger) WarnCtx(ctx context.Context, message string, customFields map[string]interface{}) {
+	l.sendCtx(ctx, logrus.WarnLevel, message, customFields)
+}
+
+// ErrorCtx sends a log with error level to the log queue including the fields attached to ctx
+func (l *StandardLogger) ErrorCtx(ctx context.Context, message string, customFields map[string]interface{}) {
+	l.sendCtx(ctx, logrus.ErrorLevel, message, customFields)
+}
+
+// DebugCtx sends a log with debug level to the log queue including the fields attached to ctx
+func (l *StandardLogger) DebugCtx(ctx context.Context, message string, customFields map[string]interface{}) {
+	l.sendCtx(ctx, logrus.DebugLevel, message, customFields)
+}
@@ -0,0 +1,91 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestContextWithFieldsLayering(t *testing.T) {
+	parent := ContextWithFields(context.Background(), map[string]interface{}{"tenant": "acme", "step": "parent"})
+	child := ContextWithFields(parent, map[string]interface{}{"step": "child", "attempt": 2})
+
+	fields := FieldsFromContext(child)
+	if len(fields) != 3 || fields["tenant"] != "acme" || fields["step"] != "child" || fields["attempt"] != 2 {
+		t.Errorf("child fields are %v", fields)
+	}
+
+	// the parent context isn't modified by the child
+	fields = FieldsFromContext(parent)
+	if len(fields) != 2 || fields["step"] != "parent" {
+		t.Errorf("parent fields are %v", fields)
+	}
+}
+
+func TestMergeContextFields(t *testing.T) {
+	ctx := ContextWithFields(context.Background(), map[string]interface{}{"tenant": "acme", "step": "ctx"})
+
+	merged := mergeContextFields(ctx, map[string]interface{}{"step": "call", "id": 7})
+	if len(merged) != 3 || merged["tenant"] != "acme" || merged["step"] != "call" || merged["id"] != 7 {
+		t.Errorf("merged fields are %v", merged)
+	}
+
+	// merging doesn't modify the fields attached to ctx
+	if FieldsFromContext(ctx)["step"] != "ctx" {
+		t.Error("the context fields were modified by the merge")
+	}
+
+	if merged := mergeContextFields(context.Background(), nil); merged != nil {
+		t.Errorf("merged %v from no fields, want nil", merged)
+	}
+}
+
+func TestContextFieldsPrecedence(t *testing.T) {
+	l := newLocalLogger(t)
+	output := &syncBuffer{}
+	l.localRoute.sink = NewWriterSink(output)
+
+	l.CustomFields["global"] = "logger"
+	l.CustomFields["overridden.by.ctx"] = "logger"
+	l.CustomFields["overridden.by.call"] = "logger"
+
+	ctx := ContextWithFields(context.Background(), map[string]interface{}{
+		"overridden.by.ctx":  "ctx",
+		"overridden.by.call": "ctx",
+		"ctx":                "ctx",
+	})
+	ctx = ContextWithRequestID(ctx, "req-1")
+
+	l.InfoCtx(ctx, "precedence", map[string]interface{}{
+		"overridden.by.call": "call",
+		RequestIDField:       "req-2",
+	})
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := l.Flush(flushCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(output.buf.Bytes()), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"global":             "logger",
+		"overridden.by.ctx":  "ctx",
+		"ctx":                "ctx",
+		"overridden.by.call": "call",
+		RequestIDField:       "req-2",
+	}
+
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s is %v, want %q", key, entry[key], value)
+		}
+	}
+}
@@ -2,13 +2,15 @@ package logpet
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -16,18 +18,35 @@ import (
 
 func (l *StandardLogger) SetupDataDogLogger(datadogEndpoint, datadogAPIKey, offlineLogsPath string, sendDebugLogs, localmode bool) error {
 
-	// if provided endpoint is empty we fallback to the default one
+	// if provided endpoint is empty we fallback to the one already set, the DD_SITE one or the default one
+	if datadogEndpoint == "" {
+		datadogEndpoint = l.ddEndpoint
+	}
+
+	if datadogEndpoint == "" && os.Getenv("DD_SITE") != "" {
+		siteEndpoint, err := DataDogSiteEndpoint(os.Getenv("DD_SITE"))
+		if err != nil {
+			return err
+		}
+		datadogEndpoint = siteEndpoint
+	}
+
 	if datadogEndpoint == "" {
 		datadogEndpoint = DataDogDefaultEndpoint
 	}
 
+	// the CloudWatch output writes to the stdout like local mode
+	if l.cloudWatch != nil {
+		localmode = true
+	}
+
 	if datadogAPIKey == "" && !localmode {
 		return fmt.Errorf("no API Key provided")
 	}
 
-	// initialize log channel only if it doesn't exist so we don't create multiple channels
-	if l.logChan == nil {
-		l.initChannel()
+	// initialize log queue only if it doesn't exist so we don't create multiple queues
+	if l.queue == nil {
+		l.queue = newLogQueue(DefaultQueueConfig())
 	}
 
 	// offline logs path
@@ -46,16 +65,36 @@ func (l *StandardLogger) SetupDataDogLogger(datadogEndpoint, datadogAPIKey, offl
 
 	l.SetDataDogEndpoint(datadogEndpoint)
 
-	l.httpClient = &http.Client{}
+	// keep the client installed with SetUpCustomHTTPClient, if any
+	if l.httpClient == nil {
+		l.httpClient = &http.Client{Timeout: defaultHTTPTimeout}
+	}
 
-	// starting log routine
-	go l.startLogRoutineListener()
+	// fallback to the default retry policy if none was provided
+	if l.retryPolicy.MaxAttempts == 0 {
+		l.retryPolicy = DefaultRetryPolicy()
+	}
 
-	return nil
-}
+	// initialize the default sinks, DataDog and the stdout used in local mode
+	if l.ddRoute == nil {
+		l.shipCtx, l.cancelShip = context.WithCancel(context.Background())
+		l.ddSink = newDataDogSink(l)
+		l.ddRoute = &sinkRoute{sink: l.ddSink, minLevel: l.ddMinLevel}
+		l.localRoute = &sinkRoute{sink: NewStdoutSink(), minLevel: logrus.TraceLevel, formatter: l.localFormatter}
+		if !l.localFormatterSet {
+			l.localRoute.formatter = defaultLocalFormatter()
+		}
+	}
+
+	// logs are shipped by the sinks, logrus output is discarded
+	l.SetOutput(ioutil.Discard)
 
-func (l *StandardLogger) initChannel() {
-	l.logChan = make(chan Log)
+	// starting log routine, only once so the queue order is kept
+	l.listenerOnce.Do(func() {
+		go l.startLogRoutineListener()
+	})
+
+	return nil
 }
 
 // EnableLocalMode assign the provided value to the client, if true it only prints log lines to the stdout
@@ -78,6 +117,27 @@ func (l *StandardLogger) SetDataDogAPIKey(APIKey string) {
 	l.ddAPIKey = APIKey
 }
 
+// SetBatchConfig assign the provided batch configuration to the client, zero values fallback to the defaults
+// and limits above the ones accepted by DataDog are capped
+func (l *StandardLogger) SetBatchConfig(config BatchConfig) {
+	l.batchConfig = config.withDataDogLimits()
+	if l.ddSink != nil {
+		l.ddSink.batcher.setConfig(l.batchConfig)
+	}
+}
+
+// SetDataDogMinLevel sets the least severe level of the logs sent to DataDog, logs are still
+// written to the sinks added with AddSink. The default is to send every level.
+func (l *StandardLogger) SetDataDogMinLevel(level logrus.Level) {
+	l.sinksMu.Lock()
+	defer l.sinksMu.Unlock()
+
+	l.ddMinLevel = level
+	if l.ddRoute != nil {
+		l.ddRoute.minLevel = level
+	}
+}
+
 // SetUpCustomHTTPClient assign the provided http client to the client
 func (l *StandardLogger) SetUpCustomHTTPClient(httpClient *http.Client) error {
 	if httpClient != nil {
@@ -88,189 +148,359 @@ func (l *StandardLogger) SetUpCustomHTTPClient(httpClient *http.Client) error {
 	return errors.New("nil http client provided")
 }
 
-// SendInfoLog sends a log with info level to the log channel
+// SendInfoLog sends a log with info level to the log queue
 func (l *StandardLogger) SendInfoLog(message string, customFields map[string]interface{}) {
-	go func() {
-		l.logChan <- Log{
-			Message:      message,
-			CustomFields: customFields,
-			Level:        logrus.InfoLevel,
-		}
-	}()
+	l.enqueue(Log{
+		Message:      message,
+		CustomFields: customFields,
+		Level:        logrus.InfoLevel,
+	})
 }
 
-// SendInfofLog sends a formatted log with info level to the log channel
+// SendInfofLog sends a formatted log with info level to the log queue
 func (l *StandardLogger) SendInfofLog(message string, customFields map[string]interface{}, args ...interface{}) {
-	l.SendInfoLog(fmt.Sprintf(message, args...), customFields)
+	l.enqueue(Log{
+		Message:      fmt.Sprintf(message, args...),
+		CustomFields: customFields,
+		Level:        logrus.InfoLevel,
+		template:     message,
+	})
 }
 
-// SendWarnLog sends a log with warning level to the log channel
+// SendWarnLog sends a log with warning level to the log queue
 func (l *StandardLogger) SendWarnLog(message string, customFields map[string]interface{}) {
-	go func() {
-		l.logChan <- Log{
-			Message:      message,
-			CustomFields: customFields,
-			Level:        logrus.WarnLevel,
-		}
-	}()
+	l.enqueue(Log{
+		Message:      message,
+		CustomFields: customFields,
+		Level:        logrus.WarnLevel,
+	})
 }
 
-// SendWarnfLog sends a formatted log with warn level to the log channel
+// SendWarnfLog sends a formatted log with warn level to the log queue
 func (l *StandardLogger) SendWarnfLog(message string, customFields map[string]interface{}, args ...interface{}) {
-	l.SendWarnLog(fmt.Sprintf(message, args...), customFields)
+	l.enqueue(Log{
+		Message:      fmt.Sprintf(message, args...),
+		CustomFields: customFields,
+		Level:        logrus.WarnLevel,
+		template:     message,
+	})
 }
 
-// SendErrLog sends a log with error level to the log channel
+// SendErrLog sends a log with error level to the log queue
 func (l *StandardLogger) SendErrLog(message string, customFields map[string]interface{}) {
-	go func() {
-		l.logChan <- Log{
-			Message:      message,
-			CustomFields: customFields,
-			Level:        logrus.ErrorLevel,
-		}
-	}()
+	l.enqueue(Log{
+		Message:      message,
+		CustomFields: customFields,
+		Level:        logrus.ErrorLevel,
+	})
 }
 
-// SendErrfLog sends a formatted log with error level to the log channel
+// SendErrfLog sends a formatted log with error level to the log queue
 func (l *StandardLogger) SendErrfLog(message string, customFields map[string]interface{}, args ...interface{}) {
-	l.SendErrLog(fmt.Sprintf(message, args...), customFields)
+	l.enqueue(Log{
+		Message:      fmt.Sprintf(message, args...),
+		CustomFields: customFields,
+		Level:        logrus.ErrorLevel,
+		template:     message,
+	})
 }
 
-// SendDebugLog sends a log with debug level to the log channel
+// SendDebugLog sends a log with debug level to the log queue
 func (l *StandardLogger) SendDebugLog(message string, customFields map[string]interface{}) {
-	go func() {
-		l.logChan <- Log{
-			Message:      message,
-			CustomFields: customFields,
-			Level:        logrus.DebugLevel,
-		}
-	}()
+	l.enqueue(Log{
+		Message:      message,
+		CustomFields: customFields,
+		Level:        logrus.DebugLevel,
+	})
 }
 
-// SendDebugfLog sends a formatted log with debug level to the log channel
+// SendDebugfLog sends a formatted log with debug level to the log queue
 func (l *StandardLogger) SendDebugfLog(message string, customFields map[string]interface{}, args ...interface{}) {
-	l.SendDebugLog(fmt.Sprintf(message, args...), customFields)
+	l.enqueue(Log{
+		Message:      fmt.Sprintf(message, args...),
+		CustomFields: customFields,
+		Level:        logrus.DebugLevel,
+		template:     message,
+	})
 }
 
-// SendFatalLog sends a log with fatal level to the log channel
+// SendFatalLog sends a log with fatal level to the log queue, then waits for the queued logs
+// to be shipped within the fatal flush timeout, calls the exit handlers and exits
 func (l *StandardLogger) SendFatalLog(message string, customFields map[string]interface{}) {
-	func() {
-		l.logChan <- Log{
-			Message:      message,
-			CustomFields: customFields,
-			Level:        logrus.FatalLevel,
-		}
-	}()
+	l.sendFatal(Log{
+		Message:      message,
+		CustomFields: customFields,
+		Level:        logrus.FatalLevel,
+	})
 }
 
-// SendFatalfLog sends a formatted log with fatal level to the log channel
+// SendFatalfLog sends a formatted log with fatal level to the log queue, then exits like SendFatalLog
 func (l *StandardLogger) SendFatalfLog(message string, customFields map[string]interface{}, args ...interface{}) {
 	l.SendFatalLog(fmt.Sprintf(message, args...), customFields)
 }
 
+// enqueue applies sampling, rate limits and deduplication then adds the log to the log queue
+// applying the configured overflow policy
+func (l *StandardLogger) enqueue(logElem Log) {
+	if l.sampler != nil && !l.sampler.admit(&logElem, &l.metrics) {
+		return
+	}
+
+	if l.dedup != nil && !l.dedup.admit(logElem) {
+		return
+	}
+
+	l.push(logElem, false)
+}
+
+// push adds the log to the log queue, if block is true it waits for room whatever the overflow policy is.
+// It returns false if the log has been discarded.
+func (l *StandardLogger) push(logElem Log, block bool) bool {
+	if !l.queue.push(logElem, block) {
+		return false
+	}
+
+	atomic.AddInt64(&l.metrics.enqueued, 1)
+
+	return true
+}
+
 // startLogRoutineListener handles the incoming logs
 func (l *StandardLogger) startLogRoutineListener() {
-	var logWriter io.Writer
-	l.SetOutput(logWriter)
+	for {
+		logElem, ok := l.queue.pop()
+		if !ok {
+			return
+		}
 
-	for logElem := range l.logChan {
+		l.handleLog(logElem)
+		l.queue.done()
+	}
+}
 
-		// ignore debug log if sendDebugLog is set to false
-		if !l.sendDebugLogs && logElem.Level == logrus.DebugLevel {
-			continue
-		}
+// handleLog converts the log to an entry and ships it
+func (l *StandardLogger) handleLog(logElem Log) {
 
-		newLog := l.AddCustomFields()
-		newLog.Message = logElem.Message
-		newLog.Level = logElem.Level
+	// ignore debug log if sendDebugLog is set to false
+	if !l.sendDebugLogs && logElem.Level == logrus.DebugLevel {
+		return
+	}
+
+	newLog := l.AddCustomFields()
+	newLog.Message = logElem.Message
+	newLog.Level = logElem.Level
+	newLog.Time = logElem.Time
+	if newLog.Time.IsZero() {
 		newLog.Time = time.Now()
+	}
 
-		newLog.Data["ddsource"] = "logpet"
+	newLog.Data["ddsource"] = "logpet"
 
-		for key, value := range logElem.CustomFields {
-			newLog.Data[key] = value
-		}
+	for key, value := range l.serviceInfo.fields() {
+		newLog.Data[key] = value
+	}
 
-		logBytes, err := newLog.Bytes()
-		if err != nil {
-			l.SendWarnLog(fmt.Sprintf("error converting log to bytes %v", err), nil)
-			continue
-		}
+	for key, value := range logElem.CustomFields {
+		newLog.Data[key] = value
+	}
 
-		// If localMode is true print the log with Println
-		if l.localMode {
-			fmt.Println(string(logBytes))
-		} else {
-			err := l.sendLogToDD(newLog, l.httpClient)
-			if err != nil {
-				log.Printf("unable to send log to DataDog, %v", err)
-				if l.saveOfflineLogs {
-					var offsaveErr error
-
-					newLog.Message = fmt.Sprintf("OFFLINE LOG at %v | %s", time.Now().String(), newLog.Message)
-
-					logBytes, offsaveErr = newLog.Bytes()
-					if offsaveErr != nil {
-						l.SendWarnLog(fmt.Sprintf("error converting log to bytes %v", offsaveErr), nil)
-						continue
-					}
-
-					offsaveErr = l.saveLogToFile(logBytes, fmt.Sprintf("log-%s.json", time.Now().Format(time.RFC3339Nano)))
-					if offsaveErr != nil {
-						fmt.Println(offsaveErr)
-					}
-				}
-
-				continue
-			}
-		}
+	// the sample rate allows to reconstruct the real counts
+	if logElem.sampleRate > 0 && logElem.sampleRate < 1 {
+		newLog.Data[SampleRateField] = logElem.sampleRate
+	}
 
-		// If it's a fatal log exit
-		if logElem.Level == logrus.FatalLevel {
-			os.Exit(1)
-		}
+	routes := l.routes()
+	if logElem.dataDogOnly {
+		routes = l.dataDogRoutes()
 	}
+
+	// errors are reported by the sinks, the log is not sent again
+	_ = l.writeToSinks(routes, newLog)
 }
 
-func (l *StandardLogger) sendLogToDD(log *logrus.Entry, httpClient *http.Client) error {
+// dataDogSink is the Sink shipping batches of entries to the DataDog logs intake
+// with the endpoint, API key and http client configured on the logger.
+type dataDogSink struct {
+	l          *StandardLogger
+	batcher    *batcher
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker
+}
 
-	// obtaining byte slice from log
-	logBytes, err := log.Bytes()
-	if err != nil {
-		return err
+func newDataDogSink(l *StandardLogger) *dataDogSink {
+	sink := &dataDogSink{l: l}
+	sink.batcher = newBatcher(l.batchConfig.withDataDogLimits(), l.shipCtx, sink.send, sink.drop)
+
+	return sink
+}
+
+// Write adds the JSON encoded entry to the current batch
+func (s *dataDogSink) Write(entry *logrus.Entry, formatted []byte) error {
+	item := make([]byte, len(bytes.TrimSpace(formatted)))
+	copy(item, bytes.TrimSpace(formatted))
+
+	s.batcher.add(item)
+
+	return nil
+}
+
+// Flush ships the current batch, returning early if ctx expires
+func (s *dataDogSink) Flush(ctx context.Context) error {
+	return s.batcher.flush(ctx)
+}
+
+// Close ships the current batch
+func (s *dataDogSink) Close(ctx context.Context) error {
+	return s.Flush(ctx)
+}
+
+// send ships a batch of encoded logs to DataDog as a JSON array, if the batch can't be shipped
+// because of a transient failure every log is saved offline when enabled. The batches rejected
+// by the intake would be rejected again when replayed, they are dropped.
+func (s *dataDogSink) send(ctx context.Context, batch [][]byte) error {
+	l := s.l
+
+	err := s.post(ctx, batch)
+	if err == nil {
+		return nil
 	}
 
-	// creating the reader from slice
-	body := bytes.NewReader(logBytes)
+	atomic.AddInt64(&l.metrics.failed, int64(len(batch)))
 
-	// parsing datadog endpoint URL
-	urlPrsd, err := url.Parse(l.ddEndpoint)
-	if err != nil {
+	if !l.saveOfflineLogs || !isRetryable(err) {
+		atomic.AddInt64(&l.metrics.droppedSendFailed, int64(len(batch)))
 		return err
 	}
 
-	// creating new request
-	req, err := http.NewRequest(http.MethodPost, urlPrsd.String(), body)
+	l.spoolLogs(batch)
+
+	return err
+}
+
+// drop saves offline, when enabled, a batch dropped because too many batches were waiting to be shipped
+func (s *dataDogSink) drop(batch [][]byte) {
+	if !s.l.saveOfflineLogs {
+		atomic.AddInt64(&s.l.metrics.droppedBacklog, int64(len(batch)))
+		return
+	}
+
+	s.l.spoolLogs(batch)
+}
+
+// post tries the DataDog endpoint and then the fallback ones, skipping the endpoints with
+// an open circuit breaker. It returns ErrCircuitOpen if no endpoint could be called.
+func (s *dataDogSink) post(ctx context.Context, batch [][]byte) error {
+	l := s.l
+
+	// creating the JSON array from the encoded logs
+	var payload bytes.Buffer
+	payload.WriteByte('[')
+	for i, logBytes := range batch {
+		if i > 0 {
+			payload.WriteByte(',')
+		}
+		payload.Write(logBytes)
+	}
+	payload.WriteByte(']')
+
+	// compressing the payload if enabled
+	payloadBytes, err := l.compression.compress(payload.Bytes())
 	if err != nil {
 		return err
 	}
 
-	// adding apikey and content type header
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("DD-API-KEY", l.ddAPIKey)
+	endpoints := append([]string{l.ddEndpoint}, l.ddFallbackEndpoints...)
 
-	// doing the request
-	resp, err := httpClient.Do(req)
+	lastErr := ErrCircuitOpen
+	for _, endpoint := range endpoints {
+		breaker := s.breaker(endpoint)
+		if !breaker.allow() {
+			continue
+		}
+
+		err := l.postPayloadToDD(ctx, endpoint, payloadBytes, l.httpClient)
+		if err == nil {
+			breaker.success()
+			l.metrics.recordSent(len(batch), len(payloadBytes))
+			return nil
+		}
+
+		// the endpoint is reachable but rejected the payload, others would reject it too
+		if !isRetryable(err) {
+			breaker.success()
+			return err
+		}
+
+		breaker.failure()
+		lastErr = err
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return lastErr
+}
+
+// breaker returns the circuit breaker of the endpoint, creating it if needed
+func (s *dataDogSink) breaker(endpoint string) *circuitBreaker {
+	s.breakersMu.Lock()
+	defer s.breakersMu.Unlock()
+
+	if s.breakers == nil {
+		s.breakers = make(map[string]*circuitBreaker)
+	}
+
+	breaker, ok := s.breakers[endpoint]
+	if !ok {
+		breaker = newCircuitBreaker(s.l.breakerConfig.withDefaults())
+		s.breakers[endpoint] = breaker
+	}
+
+	return breaker
+}
+
+// resetBreakers forgets the state of every endpoint
+func (s *dataDogSink) resetBreakers() {
+	s.breakersMu.Lock()
+	s.breakers = nil
+	s.breakersMu.Unlock()
+}
+
+func (l *StandardLogger) postPayloadToDD(ctx context.Context, endpoint string, payloadBytes []byte, httpClient *http.Client) error {
+
+	// parsing datadog endpoint URL
+	urlPrsd, err := url.Parse(endpoint)
 	if err != nil {
 		return err
 	}
 
-	defer resp.Body.Close()
+	attempts := 0
+	return l.retryPolicy.do(ctx, func(ctx context.Context) error {
+		if attempts++; attempts > 1 {
+			atomic.AddInt64(&l.metrics.retried, 1)
+		}
 
-	// if not ok return an error
-	if resp.StatusCode != 200 {
-		return errors.New(fmt.Sprintf("error when sending logs to DD | Status: %s %v", resp.Status, err))
-	}
+		// creating new request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlPrsd.String(), bytes.NewReader(payloadBytes))
+		if err != nil {
+			return err
+		}
 
-	return nil
+		// adding apikey and content type header
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("DD-API-KEY", l.ddAPIKey)
+		if l.compression.Encoding != CompressionNone {
+			req.Header.Set("Content-Encoding", l.compression.Encoding)
+		}
+
+		// doing the request
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		// if not accepted return an error
+		return checkResponse(resp)
+	})
 }
@@ -0,0 +1,94 @@
+package logpet
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDataDogSpoolsOnlyTransientFailures(t *testing.T) {
+	tests := []struct {
+		status  int
+		spooled int64
+		dropped int64
+	}{
+		{status: http.StatusServiceUnavailable, spooled: 2},
+		{status: http.StatusBadRequest, dropped: 2},
+		{status: http.StatusRequestEntityTooLarge, dropped: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			intake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+			}))
+			defer intake.Close()
+
+			dir, err := ioutil.TempDir("", "logpet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			l := NewLogger()
+			l.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+			if err := l.SetupDataDogLogger(intake.URL, "api-key", dir, false, false); err != nil {
+				t.Fatal(err)
+			}
+
+			l.SendErrLog("first", nil)
+			l.SendErrLog("second", nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// the error of the failed batch is expected
+			_ = l.Flush(ctx)
+
+			stats := l.Stats()
+			if stats.Spooled != test.spooled {
+				t.Errorf("spooled %d logs, want %d", stats.Spooled, test.spooled)
+			}
+
+			if stats.Dropped[DropReasonSendFailed] != test.dropped {
+				t.Errorf("dropped %d logs as send_failed, want %d", stats.Dropped[DropReasonSendFailed], test.dropped)
+			}
+		})
+	}
+}
+
+func TestSetupKeepsCustomHTTPClient(t *testing.T) {
+	intake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer intake.Close()
+
+	transport := &countingTransport{}
+
+	l := NewLogger()
+	if err := l.SetUpCustomHTTPClient(&http.Client{Transport: transport}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.SetupDataDogLogger(intake.URL, "api-key", "", false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	l.SendErrLog("through the custom client", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := l.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests := atomic.LoadInt64(&transport.requests); requests != 1 {
+		t.Errorf("the custom client sent %d requests, want 1", requests)
+	}
+}
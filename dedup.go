@@ -0,0 +1,182 @@
+package logpet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Attributes of the summary log emitted for suppressed duplicates
+const (
+	DedupRepeatCountField = "dedup.repeat_count"
+	DedupFirstSeenField   = "dedup.first_seen"
+	DedupLastSeenField    = "dedup.last_seen"
+)
+
+// DedupConfig controls the suppression of duplicate logs.
+type DedupConfig struct {
+	// Window is how long the occurrences following the first one are suppressed.
+	Window time.Duration
+	// Fields are the custom fields that, along with level and message, identify a duplicate.
+	Fields []string
+}
+
+// dedupEntry tracks the occurrences of a log during a window
+type dedupEntry struct {
+	log   Log
+	first time.Time
+	last  time.Time
+	count int
+}
+
+// deduplicator forwards the first occurrence of a log and emits a summary of
+// the suppressed ones when the window ends
+type deduplicator struct {
+	mu      sync.Mutex
+	config  DedupConfig
+	entries map[string]*dedupEntry
+	emit    func(Log)
+}
+
+func newDeduplicator(config DedupConfig, emit func(Log)) *deduplicator {
+	if config.Window <= 0 {
+		config.Window = defaultDedupWindow
+	}
+
+	return &deduplicator{
+		config:  config,
+		entries: make(map[string]*dedupEntry),
+		emit:    emit,
+	}
+}
+
+// admit reports whether the log must be forwarded, duplicates within the window are counted instead
+func (d *deduplicator) admit(logElem Log) bool {
+	if logElem.Level == logrus.FatalLevel {
+		return true
+	}
+
+	key := d.key(logElem)
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if entry, ok := d.entries[key]; ok {
+		entry.count++
+		entry.last = now
+		return false
+	}
+
+	entry := &dedupEntry{
+		log:   logElem,
+		first: now,
+		last:  now,
+	}
+	entry.log.CustomFields = copyFields(logElem.CustomFields)
+	d.entries[key] = entry
+
+	time.AfterFunc(d.config.Window, func() {
+		d.expire(key, entry)
+	})
+
+	return true
+}
+
+// expire ends the window of the entry emitting its summary
+func (d *deduplicator) expire(key string, entry *dedupEntry) {
+	d.mu.Lock()
+	if d.entries[key] != entry {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.entries, key)
+	d.mu.Unlock()
+
+	d.summarize(entry)
+}
+
+// flush ends every window emitting the pending summaries
+func (d *deduplicator) flush() {
+	d.mu.Lock()
+	entries := d.entries
+	d.entries = make(map[string]*dedupEntry)
+	d.mu.Unlock()
+
+	for _, entry := range entries {
+		d.summarize(entry)
+	}
+}
+
+// summarize emits a log reporting how many times the entry was suppressed, if any
+func (d *deduplicator) summarize(entry *dedupEntry) {
+	if entry.count == 0 {
+		return
+	}
+
+	summary := entry.log
+	summary.Message = fmt.Sprintf("%s (repeated %d times)", entry.log.Message, entry.count)
+	summary.CustomFields = copyFields(entry.log.CustomFields)
+	summary.CustomFields[DedupRepeatCountField] = entry.count
+	summary.CustomFields[DedupFirstSeenField] = entry.first.Format(time.RFC3339Nano)
+	summary.CustomFields[DedupLastSeenField] = entry.last.Format(time.RFC3339Nano)
+
+	d.emit(summary)
+}
+
+// key identifies duplicates by level, message and the configured fields
+func (d *deduplicator) key(logElem Log) string {
+	var key strings.Builder
+
+	key.WriteString(logElem.Level.String())
+	key.WriteByte(0)
+	key.WriteString(logElem.Message)
+
+	fields := append([]string(nil), d.config.Fields...)
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		key.WriteByte(0)
+		fmt.Fprintf(&key, "%s=%v", field, logElem.CustomFields[field])
+	}
+
+	return key.String()
+}
+
+// copyFields returns a shallow copy of the fields, never nil
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	fieldsCopy := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		fieldsCopy[key] = value
+	}
+
+	return fieldsCopy
+}
+
+// SetDeduplication suppresses the duplicates of a log sent within the window, emitting a single
+// summary with the number of repetitions and the first and last occurrence times when it ends
+func (l *StandardLogger) SetDeduplication(config DedupConfig) {
+	if l.dedup != nil {
+		l.dedup.flush()
+	}
+
+	l.dedup = newDeduplicator(config, l.enqueueSummary)
+}
+
+// DisableDeduplication stops suppressing duplicates, emitting the pending summaries
+func (l *StandardLogger) DisableDeduplication() {
+	if l.dedup != nil {
+		l.dedup.flush()
+	}
+
+	l.dedup = nil
+}
+
+// enqueueSummary adds a dedup summary to the log queue, bypassing sampling and deduplication
+func (l *StandardLogger) enqueueSummary(summary Log) {
+	l.push(summary, false)
+}
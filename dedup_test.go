@@ -0,0 +1,47 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCloseShipsPendingDuplicateSummaries(t *testing.T) {
+	l := newLocalLogger(t)
+
+	output := &syncBuffer{}
+	l.localRoute.sink = NewWriterSink(output)
+
+	l.SetDeduplication(DedupConfig{Window: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		l.SendErrLog("dependency down", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := l.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if closed := l.Stats().Dropped[DropReasonClosed]; closed != 0 {
+		t.Errorf("%d logs dropped by the closed queue, want 0", closed)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(output.buf.Bytes()), []byte{'\n'})
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want the first occurrence and the summary", len(lines))
+	}
+
+	var summary map[string]interface{}
+	if err := json.Unmarshal(lines[1], &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _ := summary[DedupRepeatCountField].(float64); count != 2 {
+		t.Errorf("summary repeat count is %v, want 2", summary[DedupRepeatCountField])
+	}
+}
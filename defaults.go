@@ -1,5 +1,7 @@
 package logpet
 
+import "github.com/sirupsen/logrus"
+
 
 // ====================================
 //
@@ -14,16 +16,22 @@ package logpet
 //
 //====================================
 
-// DatabaseAddingError prints the string "Can't add %s for %s" with a Warning error.
+// DatabaseAddingError sends the string "Can't add %s for %s" with a Warning error.
 // It accepts two strings representing the entity we want to add and the user who requested it.
 func (l *StandardLogger) DatabaseAddingError(entity, user string) {
-	l.AddCustomFields().Warningf(databaseAddError, entity, user)
+	l.sendEvent(logrus.WarnLevel, EventDatabaseAddError, map[string]interface{}{
+		EntityNameField: entity,
+		UserNameField:   user,
+	}, databaseAddError, entity, user)
 }
 
-// DatabaseGetError prints the string "Can't get %s for %s" with a Warning error.
+// DatabaseGetError sends the string "Can't get %s for %s" with a Warning error.
 // It accepts two strings representing the entity we want to add and the user who requested it.
 func (l *StandardLogger) DatabaseGetError(entity, user string) {
-	l.AddCustomFields().Warningf(databaseGetError, entity, user)
+	l.sendEvent(logrus.WarnLevel, EventDatabaseGetError, map[string]interface{}{
+		EntityNameField: entity,
+		UserNameField:   user,
+	}, databaseGetError, entity, user)
 }
 
 
@@ -33,21 +41,27 @@ func (l *StandardLogger) DatabaseGetError(entity, user string) {
 //
 //====================================
 
-// InvalidDatabaseConnection prints the string "Invalid connection to the database: %s" with a Fatal error.
+// InvalidDatabaseConnection sends the string "Invalid connection to the database: %s" with a Fatal error.
 // It accepts a string that could be the hostname of the database.
 func (l *StandardLogger) InvalidDatabaseConnection(databaseHost string) {
-	l.AddCustomFields().Fatalf(databaseConnectionError, databaseHost)
+	l.sendEvent(logrus.FatalLevel, EventDatabaseConnectionError, map[string]interface{}{
+		DatabaseHostField: databaseHost,
+	}, databaseConnectionError, databaseHost)
 }
 
-// MissingEnvVariable prints the string "Missing environment variable: %s" with a Fatal error.
+// MissingEnvVariable sends the string "Missing environment variable: %s" with a Fatal error.
 // It accepts as a string, the name of the environment variable.
 func (l *StandardLogger) MissingEnvVariable(env string) {
-	l.AddCustomFields().Fatalf(missingEnvVar, env)
+	l.sendEvent(logrus.FatalLevel, EventMissingEnvVariable, map[string]interface{}{
+		EnvVariableField: env,
+	}, missingEnvVar, env)
 }
 
-// MissingNecessaryEntity prints the string "Can't get: %s" with a Fatal error.
+// MissingNecessaryEntity sends the string "Can't get: %s" with a Fatal error.
 // It accepts as a string, the name of the entity name.
 func (l *StandardLogger) MissingNecessaryEntity(ent string) {
-	l.AddCustomFields().Fatalf(missingEntity, ent)
+	l.sendEvent(logrus.FatalLevel, EventMissingEntity, map[string]interface{}{
+		EntityNameField: ent,
+	}, missingEntity, ent)
 }
 
@@ -0,0 +1,463 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ElasticsearchConfig configures the Elasticsearch and OpenSearch bulk API sink.
+type ElasticsearchConfig struct {
+	// Endpoint is the URL of the cluster, defaults to http://localhost:9200.
+	Endpoint string
+	// Index is the target index, the Go time layouts between braces are replaced with the
+	// entry time in UTC. Defaults to logpet-{2006.01.02}, a daily index.
+	Index string
+	// Pipeline is the optional ingest pipeline applied to the documents.
+	Pipeline string
+	// Username and Password enable basic authentication.
+	Username string
+	Password string
+	// APIKey is the base64 encoded API key sent with the ApiKey authorization scheme.
+	APIKey string
+	// Headers are added to every request.
+	Headers map[string]string
+	// HTTPClient defaults to a client with a 30 seconds timeout.
+	HTTPClient  *http.Client
+	Batch       BatchConfig
+	Retry       RetryPolicy
+	Compression Compression
+	// OfflineLogsPath is the directory where the documents failed with a transient error are saved,
+	// apart from the logs of the other destinations. It defaults to the elasticsearch directory
+	// in the offline logs path of the logger when it has offline logs enabled.
+	OfflineLogsPath string
+}
+
+// ElasticsearchSink indexes batches of entries with the _bulk API. Every entry is a document
+// encoded by the formatter of the sink, which must produce a JSON object.
+// Documents rejected with a transient error are retried alone, the ones still failing are
+// saved offline and indexed again by SendOfflineLogs, the ones rejected for good are dropped.
+type ElasticsearchSink struct {
+	batchedHTTPSink
+	config  ElasticsearchConfig
+	url     string
+	header  http.Header
+	l       *StandardLogger
+	spoolMu sync.Mutex
+	spool   *spool
+}
+
+// bulkResponse is the part of the _bulk response needed to find the failed documents
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkItemResponse `json:"items"`
+}
+
+type bulkItemResponse struct {
+	Status int `json:"status"`
+	Error  struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// BulkError is returned when some documents of a bulk request have been rejected.
+type BulkError struct {
+	// Failed is the number of rejected documents.
+	Failed int
+	// Reason is the error of the first rejected document.
+	Reason string
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("%d documents rejected by the bulk API, %s", e.Failed, e.Reason)
+}
+
+// NewElasticsearchSink returns a sink indexing entries with the bulk API of the provided cluster
+func NewElasticsearchSink(config ElasticsearchConfig) (*ElasticsearchSink, error) {
+	if config.Endpoint == "" {
+		config.Endpoint = defaultElasticsearchEndpoint
+	}
+
+	if config.Index == "" {
+		config.Index = defaultElasticsearchIndex
+	}
+
+	if strings.Count(config.Index, "{") != strings.Count(config.Index, "}") {
+		return nil, fmt.Errorf("unbalanced braces in index pattern %q", config.Index)
+	}
+
+	if err := config.Compression.validate(); err != nil {
+		return nil, err
+	}
+
+	bulkURL, err := url.Parse(strings.TrimRight(config.Endpoint, "/") + "/_bulk")
+	if err != nil {
+		return nil, fmt.Errorf("invalid Elasticsearch endpoint %s, %v", config.Endpoint, err)
+	}
+
+	if config.Pipeline != "" {
+		query := bulkURL.Query()
+		query.Set("pipeline", config.Pipeline)
+		bulkURL.RawQuery = query.Encode()
+	}
+
+	header := make(http.Header)
+	for key, value := range config.Headers {
+		header.Set(key, value)
+	}
+
+	header.Set("Content-Type", "application/x-ndjson")
+
+	if config.APIKey != "" {
+		header.Set("Authorization", "ApiKey "+config.APIKey)
+	} else if config.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(config.Username + ":" + config.Password))
+		header.Set("Authorization", "Basic "+credentials)
+	}
+
+	sink := &ElasticsearchSink{
+		batchedHTTPSink: newBatchedHTTPSink(config.HTTPClient, config.Retry, config.Compression),
+		config:          config,
+		url:             bulkURL.String(),
+		header:          header,
+	}
+	sink.start(config.Batch, sink.send, sink.drop)
+
+	return sink, nil
+}
+
+func (s *ElasticsearchSink) attach(l *StandardLogger) {
+	s.l = l
+	s.batchedHTTPSink.attach(l)
+}
+
+// Write adds the create action and the formatted entry to the current batch
+func (s *ElasticsearchSink) Write(entry *logrus.Entry, formatted []byte) error {
+	document := bytes.TrimSpace(formatted)
+	if len(document) == 0 || document[0] != '{' {
+		return fmt.Errorf("the Elasticsearch documents must be JSON objects, use a JSON formatter")
+	}
+
+	action, err := json.Marshal(map[string]interface{}{
+		"create": map[string]string{"_index": expandIndex(s.config.Index, entry.Time)},
+	})
+	if err != nil {
+		return err
+	}
+
+	item := make([]byte, 0, len(action)+len(document)+2)
+	item = append(item, action...)
+	item = append(item, '\n')
+	item = append(item, document...)
+	item = append(item, '\n')
+
+	s.batcher.add(item)
+
+	return nil
+}
+
+// send posts the batch retrying only the documents failed with a transient error, the ones
+// still failing are saved offline when enabled and the ones rejected for good are dropped
+func (s *ElasticsearchSink) send(ctx context.Context, batch [][]byte) error {
+	metrics := s.shipper.metrics
+
+	pending := batch
+	var rejected [][]byte
+	var rejectErr *BulkError
+
+	err := s.shipper.retryDo(ctx, func(ctx context.Context) error {
+		retry, reject, size, err := s.bulk(ctx, pending)
+		if err != nil {
+			return err
+		}
+
+		metrics.recordSent(len(pending)-len(retry.items)-len(reject.items), size)
+
+		if len(reject.items) > 0 {
+			rejected = append(rejected, reject.items...)
+			if rejectErr == nil {
+				rejectErr = &BulkError{Reason: reject.reason}
+			}
+		}
+
+		// only the documents rejected with 429 or 5xx are sent again
+		pending = retry.items
+		if len(pending) > 0 {
+			return &BulkError{Failed: len(pending), Reason: retry.reason}
+		}
+
+		return nil
+	})
+
+	// the rejected documents would be rejected again when sent offline
+	atomic.AddInt64(&metrics.failed, int64(len(rejected)))
+	atomic.AddInt64(&metrics.droppedSendFailed, int64(len(rejected)))
+
+	if err == nil {
+		if rejectErr != nil {
+			rejectErr.Failed = len(rejected)
+			return rejectErr
+		}
+		return nil
+	}
+
+	atomic.AddInt64(&metrics.failed, int64(len(pending)))
+
+	if !isRetryable(err) || !s.saveOffline(pending) {
+		atomic.AddInt64(&metrics.droppedSendFailed, int64(len(pending)))
+	}
+
+	return err
+}
+
+// drop saves offline, when enabled, the batch dropped because too many batches were waiting to be shipped
+func (s *ElasticsearchSink) drop(batch [][]byte) {
+	if !s.saveOffline(batch) {
+		s.shipper.dropBacklog(batch)
+	}
+}
+
+// saveOffline appends the items to the spool of the sink, returning false if offline logs are disabled
+func (s *ElasticsearchSink) saveOffline(items [][]byte) bool {
+	spool, err := s.offlineSpool()
+	if err != nil {
+		atomic.AddInt64(&s.shipper.metrics.droppedSpoolFailed, int64(len(items)))
+		log.Printf("unable to save Elasticsearch documents offline, %v", err)
+		return true
+	}
+
+	if spool == nil {
+		return false
+	}
+
+	// the action and the document are saved as a JSON array on a single line
+	records := make([][]byte, 0, len(items))
+	for _, item := range items {
+		action, document := bulkItemParts(item)
+
+		record := make([]byte, 0, len(action)+len(document)+3)
+		record = append(record, '[')
+		record = append(record, action...)
+		record = append(record, ',')
+		record = append(record, document...)
+		record = append(record, ']')
+
+		records = append(records, record)
+	}
+
+	spool.appendCounting(records, s.shipper.metrics)
+
+	return true
+}
+
+// offlineSpool returns the spool of the documents failed with a transient error, nil if disabled
+func (s *ElasticsearchSink) offlineSpool() (*spool, error) {
+	s.spoolMu.Lock()
+	defer s.spoolMu.Unlock()
+
+	if s.spool != nil {
+		return s.spool, nil
+	}
+
+	dir := s.config.OfflineLogsPath
+	config := DefaultSpoolConfig()
+
+	if s.l != nil {
+		if dir == "" && s.l.saveOfflineLogs && s.l.offlineLogsPath != "" {
+			dir = filepath.Join(s.l.offlineLogsPath, elasticsearchSpoolDir)
+		}
+		config = s.l.spoolSettings()
+	}
+
+	if dir == "" {
+		return nil, nil
+	}
+
+	spool, err := openSpool(dir, config)
+	if err != nil {
+		return nil, err
+	}
+
+	s.spool = spool
+
+	return spool, nil
+}
+
+// sendOfflineLogs indexes again the documents saved offline, segment by segment from the oldest one.
+// A segment is removed once its documents have been shipped, saved offline again or dropped.
+func (s *ElasticsearchSink) sendOfflineLogs(ctx context.Context) error {
+	spool, err := s.offlineSpool()
+	if spool == nil {
+		return err
+	}
+
+	for _, segment := range spool.rotate() {
+		err := readSegment(segment, func(line []byte, lineNumber int) {
+			item, err := replayedBulkItem(line)
+			if err != nil {
+				log.Printf("unable to decode offline document %s:%d, %v", filepath.Base(segment), lineNumber, err)
+				return
+			}
+
+			s.batcher.add(item)
+			atomic.AddInt64(&s.shipper.metrics.replayed, 1)
+		})
+		if err != nil {
+			return err
+		}
+
+		// the documents failing again are already saved in a new segment
+		if err := s.batcher.flush(ctx); err != nil && ctx.Err() != nil {
+			return err
+		}
+
+		if err := spool.remove(segment); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bulkFailures holds the failed documents and the error of the first one
+type bulkFailures struct {
+	items  [][]byte
+	reason string
+}
+
+func (f *bulkFailures) add(item []byte, result bulkItemResponse) {
+	f.items = append(f.items, item)
+	if f.reason == "" {
+		f.reason = fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason)
+	}
+}
+
+// bulk posts the items once, returning the ones failed with a transient error, the ones failed
+// with a permanent error and the request size. The error is set when the whole request failed.
+func (s *ElasticsearchSink) bulk(ctx context.Context, items [][]byte) (retry, reject bulkFailures, size int, err error) {
+
+	body, err := s.shipper.compression.compress(bytes.Join(items, nil))
+	if err != nil {
+		return retry, reject, 0, err
+	}
+
+	resp, err := s.shipper.do(ctx, s.url, s.header, body)
+	if err != nil {
+		return retry, reject, 0, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return retry, reject, 0, checkResponse(resp)
+	}
+
+	defer resp.Body.Close()
+
+	var response bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return retry, reject, 0, fmt.Errorf("unable to decode the bulk response, %v", err)
+	}
+
+	if !response.Errors {
+		return retry, reject, len(body), nil
+	}
+
+	if len(response.Items) != len(items) {
+		return retry, reject, 0, fmt.Errorf("bulk response with %d items for %d documents", len(response.Items), len(items))
+	}
+
+	// every item holds a single result keyed by the action name
+	for i, result := range response.Items {
+		for _, item := range result {
+			switch {
+			case item.Status >= 200 && item.Status <= 299:
+			case (&StatusError{StatusCode: item.Status}).Retryable():
+				retry.add(items[i], item)
+			default:
+				reject.add(items[i], item)
+			}
+		}
+	}
+
+	return retry, reject, len(body), nil
+}
+
+// bulkItemParts splits a batched item in the action and the document
+func bulkItemParts(item []byte) (action, document []byte) {
+	i := bytes.IndexByte(item, '\n')
+	if i < 0 {
+		return nil, bytes.TrimSpace(item)
+	}
+
+	return item[:i], bytes.TrimSpace(item[i+1:])
+}
+
+// replayedBulkItem returns the batched item of a document saved offline, with the replayed attribute
+func replayedBulkItem(record []byte) ([]byte, error) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(record, &parts); err != nil {
+		return nil, err
+	}
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected the action and the document, got %d values", len(parts))
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(parts[1]))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	document[ReplayedField] = true
+
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	item := make([]byte, 0, len(parts[0])+len(encoded)+2)
+	item = append(item, parts[0]...)
+	item = append(item, '\n')
+	item = append(item, encoded...)
+	item = append(item, '\n')
+
+	return item, nil
+}
+
+// expandIndex replaces the time layouts between braces with the time in UTC, e.g. logs-{2006.01} is logs-2020.05
+func expandIndex(pattern string, t time.Time) string {
+	if !strings.Contains(pattern, "{") {
+		return pattern
+	}
+
+	t = t.UTC()
+
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(pattern, '{')
+		end := strings.IndexByte(pattern, '}')
+		if start < 0 || end < start {
+			b.WriteString(pattern)
+			return b.String()
+		}
+
+		b.WriteString(pattern[:start])
+		b.WriteString(t.Format(pattern[start+1 : end]))
+		pattern = pattern[end+1:]
+	}
+}
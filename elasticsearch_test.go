@@ -0,0 +1,151 @@
+package logpet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// esStandIn is a local bulk API answering every document with the status chosen by its message
+type esStandIn struct {
+	mu       sync.Mutex
+	statuses map[string]int
+	indexed  []map[string]interface{}
+}
+
+func (c *esStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type result struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+
+	var response struct {
+		Errors bool                `json:"errors"`
+		Items  []map[string]result `json:"items"`
+	}
+
+	// the action and document lines alternate
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		if !scanner.Scan() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var document map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &document); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		res := result{Status: http.StatusCreated}
+		if status, ok := c.statuses[document["msg"].(string)]; ok {
+			res.Status = status
+			res.Error.Type = http.StatusText(status)
+			response.Errors = true
+		} else {
+			c.indexed = append(c.indexed, document)
+		}
+
+		response.Items = append(response.Items, map[string]result{"create": res})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func TestElasticsearchSpoolsAndReplaysOnlyToItself(t *testing.T) {
+	cluster := &esStandIn{statuses: map[string]int{
+		"throttled": http.StatusTooManyRequests,
+		"invalid":   http.StatusBadRequest,
+	}}
+	server := httptest.NewServer(cluster)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "logpet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := NewLogger()
+	l.SetLocalFormatter(&logrus.JSONFormatter{})
+	if err := l.SetupDataDogLogger("", "", dir, true, true); err != nil {
+		t.Fatal(err)
+	}
+	local := &syncBuffer{}
+	l.localRoute.sink = NewWriterSink(local)
+
+	sink, err := NewElasticsearchSink(ElasticsearchConfig{
+		Endpoint: server.URL,
+		Retry:    RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.AddSink(sink, logrus.TraceLevel, &logrus.JSONFormatter{})
+
+	l.SendInfoLog("indexed", nil)
+	l.SendInfoLog("throttled", nil)
+	l.SendInfoLog("invalid", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, ok := l.Flush(ctx).(*BulkError); !ok {
+		t.Fatal("Flush didn't return the error of the rejected documents")
+	}
+
+	stats := l.Stats()
+	if stats.Spooled != 1 || stats.Dropped[DropReasonSendFailed] != 1 || stats.Retried != 1 {
+		t.Fatalf("spooled %d, dropped %d as send_failed and retried %d times, want 1, 1 and 1",
+			stats.Spooled, stats.Dropped[DropReasonSendFailed], stats.Retried)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, elasticsearchSpoolDir, spoolSegmentPrefix+"*"))
+	if len(segments) != 1 {
+		t.Fatalf("found %d Elasticsearch segments, want 1", len(segments))
+	}
+
+	cluster.mu.Lock()
+	delete(cluster.statuses, "throttled")
+	cluster.mu.Unlock()
+
+	if err := l.SendOfflineLogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cluster.mu.Lock()
+	defer cluster.mu.Unlock()
+
+	if len(cluster.indexed) != 2 || cluster.indexed[1]["msg"] != "throttled" || cluster.indexed[1][ReplayedField] != true {
+		t.Errorf("indexed %v, want the replayed throttled document last", cluster.indexed)
+	}
+
+	if lines := local.lines(); lines != 3 {
+		t.Errorf("the local output received %d lines, want only the 3 original logs", lines)
+	}
+
+	if segments, _ := filepath.Glob(filepath.Join(dir, elasticsearchSpoolDir, spoolSegmentPrefix+"*")); len(segments) != 0 {
+		t.Errorf("the replayed segments weren't removed, %v", segments)
+	}
+}
@@ -0,0 +1,27 @@
+package logpet
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sendEvent sends a predefined message to the log queue with its event code and parameters as attributes,
+// fatal events exit like SendFatalLog
+func (l *StandardLogger) sendEvent(level logrus.Level, code string, fields map[string]interface{}, message string, args ...interface{}) {
+	fields[EventCodeField] = code
+
+	logElem := Log{
+		Message:      fmt.Sprintf(message, args...),
+		CustomFields: fields,
+		Level:        level,
+		template:     message,
+	}
+
+	if level == logrus.FatalLevel {
+		l.sendFatal(logElem)
+		return
+	}
+
+	l.enqueue(logElem)
+}
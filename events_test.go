@@ -0,0 +1,144 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPredefinedMessagesSendEventCodeAndFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		send    func(l *StandardLogger)
+		code    string
+		level   string
+		message string
+		fields  map[string]string
+	}{
+		{
+			name:    "HTTPServerStarted",
+			send:    func(l *StandardLogger) { l.HTTPServerStarted("8080") },
+			code:    EventHTTPServerStarted,
+			level:   "info",
+			message: "Started, listening on port: 8080",
+			fields:  map[string]string{HTTPPortField: "8080"},
+		},
+		{
+			name:   "HTTPServerUnauthorizedResponse",
+			send:   func(l *StandardLogger) { l.HTTPServerUnauthorizedResponse("10.0.0.1", "/admin") },
+			code:   EventHTTPServerUnauthorized,
+			level:  "warning",
+			fields: map[string]string{HTTPClientField: "10.0.0.1", HTTPResourceField: "/admin"},
+		},
+		{
+			name:   "HTTPServerInvalidBodyResponse",
+			send:   func(l *StandardLogger) { l.HTTPServerInvalidBodyResponse("10.0.0.1") },
+			code:   EventHTTPServerInvalidBody,
+			level:  "warning",
+			fields: map[string]string{HTTPClientField: "10.0.0.1"},
+		},
+		{
+			name:   "HTTPServerSendResponseError",
+			send:   func(l *StandardLogger) { l.HTTPServerSendResponseError("broken pipe") },
+			code:   EventHTTPServerSendResponseError,
+			level:  "warning",
+			fields: map[string]string{ErrorMessageField: "broken pipe"},
+		},
+		{
+			name:    "HTTPServerStartingError",
+			send:    func(l *StandardLogger) { l.HTTPServerStartingError("8080") },
+			code:    EventHTTPServerStartingError,
+			level:   "fatal",
+			message: "Error starting HTTP server on port: 8080",
+			fields:  map[string]string{HTTPPortField: "8080"},
+		},
+		{
+			name:   "HTTPClientUnauthorized",
+			send:   func(l *StandardLogger) { l.HTTPClientUnauthorized("api.example.com") },
+			code:   EventHTTPClientUnauthorized,
+			level:  "warning",
+			fields: map[string]string{HTTPServerField: "api.example.com"},
+		},
+		{
+			name:   "HTTPClientInvalidBody",
+			send:   func(l *StandardLogger) { l.HTTPClientInvalidBody("{}", "api.example.com") },
+			code:   EventHTTPClientInvalidBody,
+			level:  "warning",
+			fields: map[string]string{HTTPBodyField: "{}", HTTPServerField: "api.example.com"},
+		},
+		{
+			name:   "DatabaseAddingError",
+			send:   func(l *StandardLogger) { l.DatabaseAddingError("order", "bob") },
+			code:   EventDatabaseAddError,
+			level:  "warning",
+			fields: map[string]string{EntityNameField: "order", UserNameField: "bob"},
+		},
+		{
+			name:   "DatabaseGetError",
+			send:   func(l *StandardLogger) { l.DatabaseGetError("order", "bob") },
+			code:   EventDatabaseGetError,
+			level:  "warning",
+			fields: map[string]string{EntityNameField: "order", UserNameField: "bob"},
+		},
+		{
+			name:   "InvalidDatabaseConnection",
+			send:   func(l *StandardLogger) { l.InvalidDatabaseConnection("db.internal") },
+			code:   EventDatabaseConnectionError,
+			level:  "fatal",
+			fields: map[string]string{DatabaseHostField: "db.internal"},
+		},
+		{
+			name:   "MissingEnvVariable",
+			send:   func(l *StandardLogger) { l.MissingEnvVariable("DB_HOST") },
+			code:   EventMissingEnvVariable,
+			level:  "fatal",
+			fields: map[string]string{EnvVariableField: "DB_HOST"},
+		},
+		{
+			name:   "MissingNecessaryEntity",
+			send:   func(l *StandardLogger) { l.MissingNecessaryEntity("tenant") },
+			code:   EventMissingEntity,
+			level:  "fatal",
+			fields: map[string]string{EntityNameField: "tenant"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newLocalLogger(t)
+			output := &syncBuffer{}
+			l.localRoute.sink = NewWriterSink(output)
+			l.SetExitFunc(func(code int) {})
+
+			test.send(l)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := l.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(bytes.TrimSpace(output.buf.Bytes()), &entry); err != nil {
+				t.Fatalf("unable to decode %q, %v", output.buf.Bytes(), err)
+			}
+
+			if entry[EventCodeField] != test.code || entry["level"] != test.level {
+				t.Errorf("%s is %v and level %v, want %s and %s", EventCodeField, entry[EventCodeField], entry["level"], test.code, test.level)
+			}
+
+			if test.message != "" && entry["msg"] != test.message {
+				t.Errorf("message is %q, want %q", entry["msg"], test.message)
+			}
+
+			for key, value := range test.fields {
+				if entry[key] != value {
+					t.Errorf("%s is %v, want %q", key, entry[key], value)
+				}
+			}
+		})
+	}
+}
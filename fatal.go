@@ -0,0 +1,111 @@
+package logpet
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetFatalFlushTimeout sets how long a fatal log waits for the queued logs to be shipped before exiting
+func (l *StandardLogger) SetFatalFlushTimeout(timeout time.Duration) {
+	l.fatalFlushTimeout = timeout
+}
+
+// SetExitCode sets the exit code used after SendFatalLog and the fatal predefined messages, the default is 1.
+// Fatal logs written with the logrus methods exit with the code provided by logrus.
+func (l *StandardLogger) SetExitCode(code int) {
+	l.exitCode = code
+}
+
+// SetExitFunc replaces the function terminating the process after a fatal log, the default is os.Exit.
+// Tests can replace it with a function recording the code instead of exiting.
+func (l *StandardLogger) SetExitFunc(exitFunc func(code int)) {
+	l.exitFunc = exitFunc
+}
+
+// RegisterExitHandler adds a function called after the fatal log has been flushed and before
+// the process exits, handlers are called in registration order.
+func (l *StandardLogger) RegisterExitHandler(handler func()) {
+	l.exitHandlers = append(l.exitHandlers, handler)
+}
+
+// sendFatal queues the fatal log, waiting for room whatever the overflow policy is, then exits
+// with the configured exit code
+func (l *StandardLogger) sendFatal(logElem Log) {
+	l.push(logElem, true)
+	l.exit(l.exitCode)
+}
+
+// fatalHook queues the fatal entries logged with the logrus methods, whose output is discarded,
+// before logrus calls the exit function
+type fatalHook struct {
+	l *StandardLogger
+}
+
+func (h *fatalHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.FatalLevel}
+}
+
+func (h *fatalHook) Fire(entry *logrus.Entry) error {
+	fields := make(map[string]interface{}, len(entry.Data))
+	for key, value := range entry.Data {
+		fields[key] = value
+	}
+
+	h.l.push(Log{
+		Message:      entry.Message,
+		CustomFields: fields,
+		Level:        logrus.FatalLevel,
+		Time:         entry.Time,
+	}, true)
+
+	return nil
+}
+
+// exit flushes the queued logs within the fatal flush timeout, saving offline the ones not
+// shipped in time, calls the exit handlers and terminates the process with the provided exit code
+func (l *StandardLogger) exit(code int) {
+	timeout := l.fatalFlushTimeout
+	if timeout <= 0 {
+		timeout = defaultFatalFlushTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	err := l.Flush(ctx)
+	cancel()
+
+	if err != nil {
+		log.Printf("unable to flush logs before exiting, %v", err)
+
+		// the logs not shipped in time, the fatal one too, are saved offline when enabled
+		ctx, cancel := context.WithTimeout(context.Background(), fatalSpoolTimeout)
+		_ = l.waitIdle(ctx)
+		l.abortShipping(ctx)
+		cancel()
+	}
+
+	for _, handler := range l.exitHandlers {
+		runExitHandler(handler)
+	}
+
+	exitFunc := l.exitFunc
+	if exitFunc == nil {
+		exitFunc = os.Exit
+	}
+
+	exitFunc(code)
+}
+
+// runExitHandler calls the handler, a panicking handler doesn't prevent the exit
+func runExitHandler(handler func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("exit handler panicked, %v", r)
+		}
+	}()
+
+	handler()
+}
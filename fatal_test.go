@@ -0,0 +1,127 @@
+package logpet
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSendFatalLogFlushesAndExits(t *testing.T) {
+	l := newLocalLogger(t)
+
+	output := &syncBuffer{}
+	l.localRoute.sink = NewWriterSink(output)
+
+	var calls []string
+	exitCode := -1
+
+	l.SetExitCode(3)
+	l.SetFatalFlushTimeout(time.Second)
+	l.RegisterExitHandler(func() { calls = append(calls, "first") })
+	l.RegisterExitHandler(func() { panic("broken handler") })
+	l.RegisterExitHandler(func() { calls = append(calls, "third") })
+	l.SetExitFunc(func(code int) { exitCode = code })
+
+	l.SendInfoLog("before", nil)
+	l.SendFatalLog("boom", map[string]interface{}{"reason": "disk"})
+
+	if exitCode != 3 {
+		t.Errorf("exited with %d, want 3", exitCode)
+	}
+
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "third" {
+		t.Errorf("exit handlers called %v, want [first third]", calls)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(output.buf.Bytes()), []byte{'\n'})
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines before exiting, want 2", len(lines))
+	}
+
+	var fatal map[string]interface{}
+	if err := json.Unmarshal(lines[1], &fatal); err != nil {
+		t.Fatal(err)
+	}
+
+	if fatal["msg"] != "boom" || fatal["level"] != "fatal" || fatal["reason"] != "disk" {
+		t.Errorf("fatal log is %v", fatal)
+	}
+}
+
+func TestLogrusFatalIsShippedBeforeExiting(t *testing.T) {
+	l := newLocalLogger(t)
+
+	output := &syncBuffer{}
+	l.localRoute.sink = NewWriterSink(output)
+
+	exitCode := -1
+	l.SetExitCode(3)
+	l.SetExitFunc(func(code int) { exitCode = code })
+
+	l.WithField("component", "db").Fatal("connection lost")
+
+	// logrus provides its own exit code
+	if exitCode != 1 {
+		t.Errorf("exited with %d, want 1", exitCode)
+	}
+
+	var fatal map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(output.buf.Bytes()), &fatal); err != nil {
+		t.Fatalf("unable to decode %q, %v", output.buf.Bytes(), err)
+	}
+
+	if fatal["msg"] != "connection lost" || fatal["level"] != "fatal" || fatal["component"] != "db" {
+		t.Errorf("fatal log is %v", fatal)
+	}
+}
+
+func TestFatalLogIsSpooledWhenTheIntakeIsDown(t *testing.T) {
+	intake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer intake.Close()
+
+	dir, err := ioutil.TempDir("", "logpet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := NewLogger()
+	// the retries outlast the fatal flush timeout
+	l.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second})
+	if err := l.SetupDataDogLogger(intake.URL, "api-key", dir, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	exitCode := -1
+	l.SetFatalFlushTimeout(100 * time.Millisecond)
+	l.SetExitFunc(func(code int) { exitCode = code })
+
+	l.SendFatalLog("boom", nil)
+
+	if exitCode != 1 {
+		t.Errorf("exited with %d, want 1", exitCode)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, spoolSegmentPrefix+"*"))
+
+	var spooled []byte
+	for _, segment := range segments {
+		data, err := ioutil.ReadFile(segment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spooled = append(spooled, data...)
+	}
+
+	if !bytes.Contains(spooled, []byte(`"boom"`)) {
+		t.Errorf("the fatal log wasn't saved offline, spooled %q", spooled)
+	}
+}
@@ -0,0 +1,93 @@
+package logpet
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Flush waits until every queued log has been handled and every sink has been flushed.
+// It returns the context error if ctx expires first, logs still queued keep being shipped in background.
+func (l *StandardLogger) Flush(ctx context.Context) error {
+	// pending duplicate summaries must be shipped too
+	if l.dedup != nil {
+		l.dedup.flush()
+	}
+
+	if err := l.waitIdle(ctx); err != nil {
+		return err
+	}
+
+	if err := l.flushCloudWatchMetrics(); err != nil {
+		return err
+	}
+
+	return l.flushSinks(ctx)
+}
+
+// Close stops accepting new logs, flushes the queued ones and closes the sinks within the ctx deadline.
+// It returns how many logs were lost during the shutdown: the ones discarded by the queue or the sinks
+// while closing and the ones still queued when ctx expired, which are discarded.
+// Logs discarded on purpose by sampling and rate limits are not counted.
+// Calling Close more than once returns the results of the first call.
+func (l *StandardLogger) Close(ctx context.Context) (int, error) {
+	l.closeOnce.Do(func() {
+		before := lostLogs(l.Stats())
+
+		// the pending duplicate summaries are queued before the queue stops accepting logs
+		if l.dedup != nil {
+			l.dedup.flush()
+		}
+
+		l.queue.close()
+
+		err := l.Flush(ctx)
+		if err != nil {
+			// logs still in the queue won't be shipped in time
+			atomic.AddInt64(&l.metrics.droppedShutdown, int64(l.queue.discard()))
+		}
+
+		if closeErr := l.closeSinks(ctx); closeErr != nil && err == nil {
+			err = closeErr
+		}
+
+		l.abortShipping(context.Background())
+
+		l.closeLost = int(lostLogs(l.Stats()) - before)
+		l.closeErr = err
+	})
+
+	return l.closeLost, l.closeErr
+}
+
+// abortShipping aborts the in-flight DataDog requests and waits within ctx for the batches
+// still waiting, which fail at once and are saved offline when enabled
+func (l *StandardLogger) abortShipping(ctx context.Context) {
+	if l.cancelShip == nil {
+		return
+	}
+
+	l.cancelShip()
+	_ = l.ddSink.batcher.flush(ctx)
+}
+
+// lostLogs returns the number of dropped logs, leaving out the ones dropped by sampling and rate limits
+func lostLogs(stats Stats) int64 {
+	return stats.TotalDropped() - stats.Dropped[DropReasonSampled] - stats.Dropped[DropReasonRateLimited]
+}
+
+// waitIdle waits until the listener has handled every queued log
+func (l *StandardLogger) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+
+	for l.queue.pending() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
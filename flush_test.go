@@ -0,0 +1,97 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// blockingSink blocks every write until released
+type blockingSink struct {
+	release chan struct{}
+	mu      sync.Mutex
+	written int
+}
+
+func (s *blockingSink) Write(entry *logrus.Entry, formatted []byte) error {
+	<-s.release
+
+	s.mu.Lock()
+	s.written++
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *blockingSink) Flush(ctx context.Context) error { return nil }
+func (s *blockingSink) Close(ctx context.Context) error { return nil }
+
+// newLocalLogger returns a logger in local mode writing to a discarded buffer
+func newLocalLogger(t *testing.T) *StandardLogger {
+	l := NewLogger()
+	l.SetLocalFormatter(&logrus.JSONFormatter{})
+	if err := l.SetupDataDogLogger("", "", "", true, true); err != nil {
+		t.Fatal(err)
+	}
+	l.localRoute.sink = NewWriterSink(&bytes.Buffer{})
+
+	return l
+}
+
+func TestCloseReportsLogsLostDuringShutdown(t *testing.T) {
+	l := newLocalLogger(t)
+
+	sink := &blockingSink{release: make(chan struct{})}
+	l.AddSink(sink, logrus.TraceLevel, nil)
+
+	for i := 0; i < 5; i++ {
+		l.SendInfoLog("queued", nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	lost, err := l.Close(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Close returned %v, want the deadline error", err)
+	}
+
+	// the log being written when ctx expired is still delivered
+	close(sink.release)
+
+	if lost != 4 {
+		t.Errorf("Close reported %d lost logs, want 4", lost)
+	}
+
+	if again, _ := l.Close(context.Background()); again != lost {
+		t.Errorf("second Close reported %d lost logs, want %d", again, lost)
+	}
+}
+
+func TestCloseIgnoresRateLimitedLogs(t *testing.T) {
+	l := newLocalLogger(t)
+	l.SetSampling(SamplingConfig{
+		LevelLimits: map[logrus.Level]RateLimit{logrus.InfoLevel: {PerSecond: 0.001, Burst: 1}},
+	})
+
+	for i := 0; i < 5; i++ {
+		l.SendInfoLog("limited", nil)
+	}
+
+	lost, err := l.Close(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lost != 0 {
+		t.Errorf("Close reported %d lost logs, want 0", lost)
+	}
+
+	if limited := l.Stats().Dropped[DropReasonRateLimited]; limited != 4 {
+		t.Errorf("rate limited %d logs, want 4", limited)
+	}
+}
@@ -0,0 +1,225 @@
+package logpet
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogfmtFormatter encodes entries as logfmt lines: time, level, message and the fields sorted by key,
+// e.g. time=2020-05-04T10:00:00Z level=info msg="user created" user.name=bob
+type LogfmtFormatter struct {
+	// TimestampFormat defaults to RFC 3339.
+	TimestampFormat string
+	// DisableTimestamp omits the time key.
+	DisableTimestamp bool
+	// FieldMap renames the time, level and message keys, defaults to time, level and msg.
+	FieldMap logrus.FieldMap
+}
+
+// Format encodes the entry, the DataDog specific attributes are omitted
+func (f *LogfmtFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	timestampFormat := f.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = time.RFC3339
+	}
+
+	var b bytes.Buffer
+
+	if !f.DisableTimestamp {
+		writeLogfmtPair(&b, logfmtKey(f.FieldMap[logrus.FieldKeyTime], "time"), entry.Time.Format(timestampFormat))
+	}
+	writeLogfmtPair(&b, logfmtKey(f.FieldMap[logrus.FieldKeyLevel], "level"), levelName(entry.Level))
+	writeLogfmtPair(&b, logfmtKey(f.FieldMap[logrus.FieldKeyMsg], "msg"), entry.Message)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		if key != "ddsource" && key != "ddtags" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		writeLogfmtPair(&b, key, fieldString(entry.Data[key]))
+	}
+
+	b.WriteByte('\n')
+
+	return b.Bytes(), nil
+}
+
+// logfmtKey returns the key set with FieldMap or the default one
+func logfmtKey(key, fallback string) string {
+	if key == "" {
+		return fallback
+	}
+
+	return key
+}
+
+// writeLogfmtPair writes key=value separated by a space from the previous pair, the key is
+// sanitized and the value quoted when needed
+func writeLogfmtPair(b *bytes.Buffer, key, value string) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+
+	key = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, key)
+
+	b.WriteString(key)
+	b.WriteByte('=')
+
+	if logfmtNeedsQuoting(value) {
+		b.WriteString(strconv.Quote(value))
+	} else {
+		b.WriteString(value)
+	}
+}
+
+// logfmtNeedsQuoting reports whether the value is empty or holds spaces, quotes, equal signs or control characters
+func logfmtNeedsQuoting(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f || r == utf8.RuneError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ecsFieldNames maps the attributes set by logpet to the Elastic Common Schema field names,
+// the attributes already named after ECS, like user.name and error.message, are kept as they are
+var ecsFieldNames = map[string]string{
+	HTTPPortField:            "server.port",
+	HTTPServerField:          "server.address",
+	HTTPClientField:          "client.address",
+	HTTPResourceField:        "url.path",
+	HTTPBodyField:            "http.request.body.content",
+	HTTPMethodField:          "http.request.method",
+	HTTPURLField:             "url.original",
+	HTTPHeadersField:         "http.request.headers",
+	HTTPQueryParametersField: "url.query",
+	HTTPPathParametersField:  "url.path_parameters",
+	RequestIDField:           "http.request.id",
+	TraceIDField:             "trace.id",
+	SpanIDField:              "span.id",
+	logrus.ErrorKey:          "error.message",
+	"service":                "service.name",
+	"hostname":               "host.hostname",
+}
+
+// ECSFormatter encodes entries as Elastic Common Schema JSON documents, with the attributes set
+// by logpet mapped to the ECS field names. Dotted names are nested, e.g. {"user":{"name":"bob"}}.
+// When an entry has both the logrus error and ErrorMessageField, the error is sent as error.cause.
+type ECSFormatter struct{}
+
+// Format encodes the entry as a single-line ECS document
+func (f *ECSFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	document := make(map[string]interface{}, len(entry.Data)+4)
+
+	fields := make(map[string]interface{}, len(entry.Data)+4)
+	for key, value := range entry.Data {
+		switch key {
+		case "ddsource":
+			continue
+		case "ddtags":
+			// env and version are service fields, the remaining tags are ECS tags
+			tags, _ := value.(string)
+			for _, tag := range parseTags(tags) {
+				switch {
+				case strings.HasPrefix(tag, "env:"):
+					fields["service.environment"] = strings.TrimPrefix(tag, "env:")
+				case strings.HasPrefix(tag, "version:"):
+					fields["service.version"] = strings.TrimPrefix(tag, "version:")
+				default:
+					if list, ok := fields["tags"].([]string); ok {
+						fields["tags"] = append(list, tag)
+					} else {
+						fields["tags"] = []string{tag}
+					}
+				}
+			}
+			continue
+		}
+
+		// the message set by the predefined messages wins, the logrus error is kept as its cause
+		if _, ok := entry.Data[ErrorMessageField]; ok && key == logrus.ErrorKey {
+			key = ecsErrorCauseField
+		} else if name, ok := ecsFieldNames[key]; ok {
+			key = name
+		}
+
+		fields[key] = normalizeValue(value)
+	}
+
+	fields["@timestamp"] = entry.Time.UTC().Format(ecsTimestampFormat)
+	fields["log.level"] = levelName(entry.Level)
+	fields["message"] = entry.Message
+	fields["ecs.version"] = ecsVersion
+
+	// sorting the keys so a dotted key always meets its parents first
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		setNested(document, key, fields[key])
+	}
+
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(encoded, '\n'), nil
+}
+
+// setNested sets the value at the dotted path, creating the parent objects. If a parent is
+// already set to a value that isn't an object the dotted key is kept as it is.
+func setNested(document map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+
+	current := document
+	for _, part := range parts[:len(parts)-1] {
+		next, exists := current[part]
+		if !exists {
+			child := make(map[string]interface{})
+			current[part] = child
+			current = child
+			continue
+		}
+
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			document[path] = value
+			return
+		}
+		current = child
+	}
+
+	last := parts[len(parts)-1]
+	if _, exists := current[last]; exists {
+		document[path] = value
+		return
+	}
+
+	current[last] = value
+}
@@ -0,0 +1,202 @@
+package logpet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestECSFormatterMapsRequestAttributes(t *testing.T) {
+	entry := &logrus.Entry{
+		Time:    time.Date(2020, 5, 4, 10, 30, 0, 0, time.UTC),
+		Level:   logrus.WarnLevel,
+		Message: "Can't send the response",
+		Data: logrus.Fields{
+			HTTPMethodField:          "POST",
+			HTTPURLField:             "/orders",
+			HTTPHeadersField:         map[string]string{"Accept": "application/json"},
+			HTTPQueryParametersField: "page=2",
+			HTTPPathParametersField:  map[string]string{"id": "42"},
+			ErrorMessageField:        "broken pipe",
+			logrus.ErrorKey:          errors.New("write tcp: broken pipe"),
+		},
+	}
+
+	formatted, err := (&ECSFormatter{}).Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document struct {
+		HTTP struct {
+			Request struct {
+				Method  string            `json:"method"`
+				Headers map[string]string `json:"headers"`
+			} `json:"request"`
+		} `json:"http"`
+		URL struct {
+			Original       string            `json:"original"`
+			Query          string            `json:"query"`
+			PathParameters map[string]string `json:"path_parameters"`
+		} `json:"url"`
+		Error struct {
+			Message string `json:"message"`
+			Cause   string `json:"cause"`
+		} `json:"error"`
+	}
+
+	if err := json.Unmarshal(formatted, &document); err != nil {
+		t.Fatalf("invalid ECS document %s, %v", formatted, err)
+	}
+
+	if document.HTTP.Request.Method != "POST" || document.HTTP.Request.Headers["Accept"] != "application/json" {
+		t.Errorf("http.request is %+v", document.HTTP.Request)
+	}
+
+	if document.URL.Original != "/orders" || document.URL.Query != "page=2" || document.URL.PathParameters["id"] != "42" {
+		t.Errorf("url is %+v", document.URL)
+	}
+
+	if document.Error.Message != "broken pipe" || document.Error.Cause != "write tcp: broken pipe" {
+		t.Errorf("error is %+v", document.Error)
+	}
+}
+
+// withTerminal makes the stdout look like a terminal or not until the returned function is called
+func withTerminal(terminal bool) func() {
+	previous := stdoutIsTerminal
+	stdoutIsTerminal = func() bool { return terminal }
+
+	return func() { stdoutIsTerminal = previous }
+}
+
+func TestConsoleFormatterColors(t *testing.T) {
+	entry := &logrus.Entry{
+		Time:    time.Date(2020, 5, 4, 10, 30, 0, 0, time.UTC),
+		Level:   logrus.ErrorLevel,
+		Message: "write failed",
+		Data:    logrus.Fields{"path": "/tmp"},
+	}
+
+	tests := []struct {
+		name      string
+		formatter *ConsoleFormatter
+		terminal  bool
+		colored   bool
+	}{
+		{name: "terminal", formatter: &ConsoleFormatter{}, terminal: true, colored: true},
+		{name: "piped", formatter: &ConsoleFormatter{}},
+		{name: "forced", formatter: &ConsoleFormatter{ForceColors: true}, colored: true},
+		{name: "disabled on a terminal", formatter: &ConsoleFormatter{DisableColors: true}, terminal: true},
+		{name: "disabled wins over forced", formatter: &ConsoleFormatter{ForceColors: true, DisableColors: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer withTerminal(test.terminal)()
+
+			formatted, err := test.formatter.Format(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "10:30:00.000 ERROR write failed  path=/tmp\n"
+			if test.colored {
+				want = "10:30:00.000 \x1b[31mERROR\x1b[0m write failed  \x1b[90mpath\x1b[0m=/tmp\n"
+			}
+
+			if string(formatted) != want {
+				t.Errorf("formatted %q, want %q", formatted, want)
+			}
+		})
+	}
+}
+
+func TestConsoleFormatterFields(t *testing.T) {
+	entry := &logrus.Entry{
+		Time:    time.Date(2020, 5, 4, 10, 30, 0, 0, time.UTC),
+		Level:   logrus.WarnLevel,
+		Message: "slow query",
+		Data: logrus.Fields{
+			"table":    "orders",
+			"duration": 1.5,
+			"query":    "select *",
+			"stack":    "main.go:10\nquery.go:20\n",
+			"filters":  map[string]int{"limit": 10},
+			"service":  "billing",
+			"ddsource": "logpet",
+		},
+	}
+
+	formatted, err := (&ConsoleFormatter{DisableColors: true}).Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sorted keys, service metadata left out and multi-line values last
+	want := "10:30:00.000 WARN  slow query  duration=1.5  filters={\"limit\":10}  query=\"select *\"  table=orders\n" +
+		"    stack:\n        main.go:10\n        query.go:20\n"
+
+	if string(formatted) != want {
+		t.Errorf("formatted %q, want %q", formatted, want)
+	}
+}
+
+func TestLocalFormatter(t *testing.T) {
+	tests := []struct {
+		name      string
+		terminal  bool
+		formatter logrus.Formatter
+		set       bool
+		console   bool
+	}{
+		{name: "console on a terminal", terminal: true, console: true},
+		{name: "logger formatter when piped"},
+		{name: "override on a terminal", terminal: true, formatter: &logrus.JSONFormatter{}, set: true},
+		{name: "override when piped", formatter: &ConsoleFormatter{}, set: true, console: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer withTerminal(test.terminal)()
+
+			l := NewLogger()
+			if test.set {
+				l.SetLocalFormatter(test.formatter)
+			}
+			if err := l.SetupDataDogLogger("", "", "", true, true); err != nil {
+				t.Fatal(err)
+			}
+
+			local := &syncBuffer{}
+			l.localRoute.sink = NewWriterSink(local)
+
+			// the other sinks keep the formatter of the logger
+			other := &syncBuffer{}
+			l.AddSink(NewWriterSink(other), logrus.TraceLevel, nil)
+
+			l.SendInfoLog("local", nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := l.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			localOutput := local.buf.String()
+			if console := !strings.HasPrefix(localOutput, "{"); console != test.console {
+				t.Errorf("local output is %q, want console format %v", localOutput, test.console)
+			}
+
+			if otherOutput := other.buf.String(); !strings.HasPrefix(otherOutput, "{") {
+				t.Errorf("the other sink output is %q, want the JSON formatter of the logger", otherOutput)
+			}
+		})
+	}
+}
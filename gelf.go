@@ -0,0 +1,223 @@
+package logpet
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Transports of the GELF sink
+const (
+	GELFUDP = "udp"
+	GELFTCP = "tcp"
+)
+
+// GELFConfig configures the Graylog Extended Log Format sink.
+type GELFConfig struct {
+	// Network is GELFUDP or GELFTCP.
+	Network string
+	// Address is the host:port of the GELF input.
+	Address string
+	// Host defaults to DD_HOSTNAME or the one reported by the kernel.
+	Host string
+	// Severities overrides the level of the provided logrus levels, the other ones use DefaultSyslogSeverities.
+	Severities map[logrus.Level]SyslogSeverity
+	// Compression of the UDP messages, CompressionGzip or CompressionDeflate (zlib). Defaults to gzip.
+	// TCP messages are never compressed since GELF doesn't support it.
+	Compression Compression
+	// DisableCompression sends the UDP messages uncompressed.
+	DisableCompression bool
+	// ChunkSize is the maximum size of a UDP datagram, larger messages are chunked. Defaults to 1420 bytes.
+	ChunkSize int
+	// Timeout of dials and writes, defaults to 30 seconds.
+	Timeout time.Duration
+	// Batch controls how many messages are written at once, they are written from a separate goroutine.
+	Batch BatchConfig
+}
+
+// GELFSink sends every entry as a GELF 1.1 message to Graylog. The message is the short_message,
+// the custom fields are additional fields and the level is the syslog severity.
+// UDP messages are compressed and chunked when larger than ChunkSize, TCP messages are null-byte delimited.
+// The connection is opened at the first write.
+type GELFSink struct {
+	batchedNetSink
+	config     GELFConfig
+	severities map[logrus.Level]SyslogSeverity
+}
+
+// NewGELFSink returns a sink sending entries to the GELF input
+func NewGELFSink(config GELFConfig) (*GELFSink, error) {
+	if config.Network != GELFUDP && config.Network != GELFTCP {
+		return nil, fmt.Errorf("unsupported GELF network %q", config.Network)
+	}
+
+	if config.Address == "" {
+		return nil, fmt.Errorf("no GELF address provided")
+	}
+
+	if config.Host == "" {
+		config.Host = serviceInfoFromEnv().Hostname
+	}
+
+	if config.DisableCompression || config.Network == GELFTCP {
+		config.Compression = Compression{}
+	} else if config.Compression.Encoding == CompressionNone {
+		config.Compression.Encoding = CompressionGzip
+	}
+
+	if err := config.Compression.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = defaultGELFChunkSize
+	}
+
+	if config.ChunkSize <= gelfChunkHeaderSize {
+		return nil, fmt.Errorf("GELF chunk size must be greater than %d bytes", gelfChunkHeaderSize)
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+
+	severities := DefaultSyslogSeverities()
+	for level, severity := range config.Severities {
+		severities[level] = severity
+	}
+
+	sink := &GELFSink{
+		config:     config,
+		severities: severities,
+	}
+
+	// UDP messages are chunked when written, TCP ones are already delimited
+	var packets func(message []byte) ([][]byte, error)
+	if config.Network == GELFUDP {
+		packets = sink.chunks
+	}
+
+	sink.batchedNetSink = newBatchedNetSink(newNetSender(config.Network, config.Address, nil, config.Timeout), packets)
+	sink.start(config.Batch)
+
+	return sink, nil
+}
+
+// Write adds the entry as a GELF message to the current batch, the formatted bytes are not used
+func (s *GELFSink) Write(entry *logrus.Entry, formatted []byte) error {
+	message, err := s.message(entry)
+	if err != nil {
+		return err
+	}
+
+	if s.config.Network == GELFTCP {
+		message = append(message, 0)
+	}
+
+	s.batcher.add(message)
+
+	return nil
+}
+
+// message encodes the entry as a GELF 1.1 JSON message
+func (s *GELFSink) message(entry *logrus.Entry) ([]byte, error) {
+	severity, ok := s.severities[entry.Level]
+	if !ok {
+		severity = SyslogDebug
+	}
+
+	message := make(map[string]interface{}, len(entry.Data)+6)
+	for key, value := range entry.Data {
+		if key == "ddsource" || key == "ddtags" || key == "hostname" {
+			continue
+		}
+
+		name := gelfFieldName(key)
+
+		// _id is reserved by Graylog
+		if name == "id" {
+			name = "id_"
+		}
+
+		// additional field values are strings or numbers
+		switch v := normalizeValue(value).(type) {
+		case int64, float64:
+			message["_"+name] = v
+		default:
+			message["_"+name] = fieldString(value)
+		}
+	}
+
+	message["version"] = "1.1"
+	message["host"] = s.config.Host
+	message["timestamp"] = json.Number(fmt.Sprintf("%d.%03d", entry.Time.Unix(), entry.Time.Nanosecond()/int(time.Millisecond)))
+	message["level"] = int(severity)
+
+	// the first line is the summary, the whole message is kept as full_message
+	if i := strings.IndexByte(entry.Message, '\n'); i >= 0 {
+		message["short_message"] = entry.Message[:i]
+		message["full_message"] = entry.Message
+	} else {
+		message["short_message"] = entry.Message
+	}
+
+	return json.Marshal(message)
+}
+
+// chunks compresses the message and splits it in datagrams of at most ChunkSize bytes
+func (s *GELFSink) chunks(message []byte) ([][]byte, error) {
+	payload, err := s.config.Compression.compress(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) <= s.config.ChunkSize {
+		return [][]byte{payload}, nil
+	}
+
+	dataSize := s.config.ChunkSize - gelfChunkHeaderSize
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("GELF message of %d bytes exceeds %d chunks", len(payload), gelfMaxChunks)
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		data := payload[i*dataSize:]
+		if len(data) > dataSize {
+			data = data[:dataSize]
+		}
+
+		// magic bytes, message ID, sequence number and sequence count
+		chunk := make([]byte, 0, gelfChunkHeaderSize+len(data))
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data...)
+
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// gelfFieldName replaces the characters not allowed in an additional field name with underscores
+func gelfFieldName(key string) string {
+	return strings.Map(func(r rune) rune {
+		valid := r == '_' || r == '.' || r == '-' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !valid {
+			return '_'
+		}
+		return r
+	}, key)
+}
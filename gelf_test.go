@@ -0,0 +1,244 @@
+package logpet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readGELFMessage reads the chunks of a message from the UDP listener and returns the reassembled payload
+func readGELFMessage(t *testing.T, conn net.PacketConn) []byte {
+	var id []byte
+	var parts [][]byte
+	received := 0
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	buf := make([]byte, 64*1024)
+	for parts == nil || received < len(parts) {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk := append([]byte(nil), buf[:n]...)
+
+		if chunk[0] != 0x1e || chunk[1] != 0x0f {
+			if parts != nil {
+				t.Fatalf("received an unchunked datagram between the chunks of a message")
+			}
+			return chunk
+		}
+
+		if len(chunk) <= gelfChunkHeaderSize {
+			t.Fatalf("received a chunk of %d bytes", len(chunk))
+		}
+
+		seq, count := int(chunk[10]), int(chunk[11])
+		if count > gelfMaxChunks || seq >= count {
+			t.Fatalf("received chunk %d of %d", seq, count)
+		}
+
+		if parts == nil {
+			id = chunk[2:10]
+			parts = make([][]byte, count)
+		}
+
+		if !bytes.Equal(chunk[2:10], id) || count != len(parts) {
+			t.Fatalf("the chunks of a message have different ids or counts")
+		}
+
+		if parts[seq] != nil {
+			t.Fatalf("received chunk %d twice", seq)
+		}
+
+		parts[seq] = chunk[gelfChunkHeaderSize:]
+		received++
+	}
+
+	return bytes.Join(parts, nil)
+}
+
+func TestGELFSinkChunksUDPMessages(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink, err := NewGELFSink(GELFConfig{
+		Network:   GELFUDP,
+		Address:   conn.LocalAddr().String(),
+		Host:      "host",
+		ChunkSize: 200,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := newLocalLogger(t)
+	l.AddSink(sink, logrus.TraceLevel, nil)
+
+	// random data doesn't compress, so the message needs several chunks
+	random := make([]byte, 1000)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	details := hex.EncodeToString(random)
+
+	l.SendErrLog("upload failed\n"+details, map[string]interface{}{
+		"id":         "42",
+		"bytes":      1024,
+		"user email": "user@example.com",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := l.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(readGELFMessage(t, conn)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var message map[string]interface{}
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "host",
+		"level":         float64(SyslogError),
+		"short_message": "upload failed",
+		"full_message":  "upload failed\n" + details,
+		"_id_":          "42",
+		"_bytes":        float64(1024),
+		"_user_email":   "user@example.com",
+	}
+
+	for key, value := range want {
+		if message[key] != value {
+			t.Errorf("%s is %v, want %v", key, message[key], value)
+		}
+	}
+
+	// _id is reserved by Graylog
+	if _, ok := message["_id"]; ok {
+		t.Error("the message has the reserved _id field")
+	}
+
+	if _, ok := message["timestamp"].(float64); !ok {
+		t.Errorf("the timestamp %v isn't a number", message["timestamp"])
+	}
+}
+
+func TestGELFChunkLimit(t *testing.T) {
+	sink, err := NewGELFSink(GELFConfig{
+		Network:            GELFUDP,
+		Address:            "127.0.0.1:12201",
+		DisableCompression: true,
+		ChunkSize:          gelfChunkHeaderSize + 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close(context.Background())
+
+	chunks, err := sink.chunks(make([]byte, gelfMaxChunks*10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chunks) != gelfMaxChunks {
+		t.Fatalf("split the message in %d chunks, want %d", len(chunks), gelfMaxChunks)
+	}
+
+	for i, chunk := range chunks {
+		if int(chunk[10]) != i || int(chunk[11]) != gelfMaxChunks || !bytes.Equal(chunk[2:10], chunks[0][2:10]) {
+			t.Fatalf("chunk %d has the header %x", i, chunk[:gelfChunkHeaderSize])
+		}
+	}
+
+	if _, err := sink.chunks(make([]byte, gelfMaxChunks*10+1)); err == nil {
+		t.Error("a message needing more than 128 chunks was chunked")
+	}
+
+	if chunks, _ := sink.chunks(make([]byte, gelfChunkHeaderSize+10)); len(chunks) != 1 || chunks[0][0] == 0x1e {
+		t.Error("a message fitting a datagram was chunked")
+	}
+}
+
+func TestGELFSinkDelimitsTCPMessages(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink, err := NewGELFSink(GELFConfig{Network: GELFTCP, Address: listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := newLocalLogger(t)
+	l.AddSink(sink, logrus.TraceLevel, nil)
+
+	l.SendInfoLog("first", nil)
+	l.SendInfoLog("second", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := l.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := l.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := bytes.Split(bytes.TrimSuffix(data, []byte{0}), []byte{0})
+	if len(messages) != 2 {
+		t.Fatalf("received %d null-delimited messages, want 2", len(messages))
+	}
+
+	for i, want := range []string{"first", "second"} {
+		var message map[string]interface{}
+		if err := json.Unmarshal(messages[i], &message); err != nil {
+			t.Fatal(err)
+		}
+
+		if message["short_message"] != want {
+			t.Errorf("message %d is %v, want %q", i, message["short_message"], want)
+		}
+	}
+}
@@ -14,7 +14,7 @@ func (l *StandardLogger) SendGinRequestLog(ctx *gin.Context, body interface{}) {
 		l.SendWarnfLog("Error during json marshalling in SendGinRequestLog: %v", nil, err)
 	}
 
-	customFields["http.body"] = string(res)
+	customFields[HTTPBodyField] = string(res)
 
 	// Remove Bearer token from headers before logging
 	headers := make(map[string]interface{}, len(ctx.Request.Header))
@@ -26,9 +26,9 @@ func (l *StandardLogger) SendGinRequestLog(ctx *gin.Context, body interface{}) {
 		headers[key] = value[len(value)-1]
 	}
 
-	customFields["http.headers"] = headers
-	customFields["http.query_parameters"] = ctx.Request.URL.RawQuery
-	customFields["http.path_parameters"] = ctx.Request.URL.Path
+	customFields[HTTPHeadersField] = headers
+	customFields[HTTPQueryParametersField] = ctx.Request.URL.RawQuery
+	customFields[HTTPPathParametersField] = ctx.Request.URL.Path
 
 	l.SendDebugfLog("New request received", customFields)
 }
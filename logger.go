@@ -10,6 +10,17 @@ func NewLogger() *StandardLogger {
 	var standardLogger = &StandardLogger{
 		Logger:       logrus.New(),
 		CustomFields: make(map[string]interface{}),
+		queue:        newLogQueue(DefaultQueueConfig()),
+		ddMinLevel:   logrus.TraceLevel,
+		serviceInfo:  serviceInfoFromEnv(),
+		exitCode:     1,
+	}
+
+	// fatal logs written directly with logrus are queued and exit like SendFatalLog,
+	// with the code provided by logrus
+	standardLogger.AddHook(&fatalHook{l: standardLogger})
+	standardLogger.ExitFunc = func(code int) {
+		standardLogger.exit(code)
 	}
 
 	standardLogger.Formatter = &logrus.JSONFormatter{
@@ -0,0 +1,311 @@
+package logpet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Encodings of the Loki push requests
+const (
+	LokiEncodingJSON     = "json"
+	LokiEncodingProtobuf = "protobuf"
+)
+
+// LokiLevelLabel is the label holding the level of the entry when listed in LokiConfig.Labels
+const LokiLevelLabel = "level"
+
+// LokiConfig configures the Grafana Loki push API sink.
+type LokiConfig struct {
+	// Endpoint is the URL of the push API, defaults to http://localhost:3100/loki/api/v1/push.
+	Endpoint string
+	// Encoding is LokiEncodingJSON or LokiEncodingProtobuf, protobuf requests are snappy compressed.
+	// Defaults to protobuf.
+	Encoding string
+	// Labels are the fields used as stream labels, defaults to service and level.
+	// Every distinct combination of values is a stream so only low-cardinality fields should be listed.
+	Labels []string
+	// StaticLabels are added to every stream.
+	StaticLabels map[string]string
+	// TenantID is sent as X-Scope-OrgID when Loki runs in multi-tenant mode.
+	TenantID string
+	// Headers are added to every request, e.g. for authentication.
+	Headers map[string]string
+	// HTTPClient defaults to a client with a 30 seconds timeout.
+	HTTPClient *http.Client
+	Batch      BatchConfig
+	Retry      RetryPolicy
+	// Compression of the JSON requests, protobuf ones are always snappy compressed.
+	Compression Compression
+}
+
+// LokiSink ships batches of entries to the Loki push API, grouped in streams by their labels.
+// The fields not used as labels are sent as a JSON line along with the message.
+type LokiSink struct {
+	batchedHTTPSink
+	config LokiConfig
+	header http.Header
+	labels map[string]string
+}
+
+// lokiEntry is a batched entry, it's decoded and grouped by stream when the batch is shipped
+type lokiEntry struct {
+	Labels    map[string]string `json:"labels"`
+	Timestamp int64             `json:"ts"`
+	Line      string            `json:"line"`
+}
+
+// lokiStream is the set of entries sharing the same labels
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+// NewLokiSink returns a sink shipping entries to the Loki push API
+func NewLokiSink(config LokiConfig) (*LokiSink, error) {
+	if config.Endpoint == "" {
+		config.Endpoint = defaultLokiEndpoint
+	}
+
+	if config.Encoding == "" {
+		config.Encoding = LokiEncodingProtobuf
+	}
+
+	if config.Labels == nil {
+		config.Labels = []string{"service", LokiLevelLabel}
+	}
+
+	header := make(http.Header)
+	for key, value := range config.Headers {
+		header.Set(key, value)
+	}
+
+	if config.TenantID != "" {
+		header.Set("X-Scope-OrgID", config.TenantID)
+	}
+
+	switch config.Encoding {
+	case LokiEncodingJSON:
+		header.Set("Content-Type", "application/json")
+	case LokiEncodingProtobuf:
+		if config.Compression.Encoding != CompressionNone {
+			return nil, fmt.Errorf("content encoding %q not supported by Loki protobuf requests, they are snappy compressed", config.Compression.Encoding)
+		}
+		header.Set("Content-Type", "application/x-protobuf")
+	default:
+		return nil, fmt.Errorf("unsupported Loki encoding %q", config.Encoding)
+	}
+
+	if err := config.Compression.validate(); err != nil {
+		return nil, err
+	}
+
+	sink := &LokiSink{
+		batchedHTTPSink: newBatchedHTTPSink(config.HTTPClient, config.Retry, config.Compression),
+		config:          config,
+		header:          header,
+		labels:          make(map[string]string, len(config.Labels)),
+	}
+	sink.start(config.Batch, sink.send, nil)
+
+	for _, field := range config.Labels {
+		sink.labels[field] = lokiLabelName(field)
+	}
+
+	return sink, nil
+}
+
+// Write splits the entry in stream labels and line and adds it to the current batch
+func (s *LokiSink) Write(entry *logrus.Entry, formatted []byte) error {
+	labels := make(map[string]string, len(s.config.StaticLabels)+len(s.labels))
+	for name, value := range s.config.StaticLabels {
+		labels[name] = value
+	}
+
+	line := make(map[string]interface{}, len(entry.Data)+1)
+	for key, value := range entry.Data {
+		if name, ok := s.labels[key]; ok {
+			labels[name] = fieldString(value)
+			continue
+		}
+
+		// the DataDog specific attributes are useless in Loki
+		if key == "ddsource" || key == "ddtags" {
+			continue
+		}
+
+		line[key] = normalizeValue(value)
+	}
+
+	if name, ok := s.labels[LokiLevelLabel]; ok {
+		labels[name] = levelName(entry.Level)
+	}
+
+	line["message"] = entry.Message
+
+	encodedLine, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	item, err := json.Marshal(lokiEntry{
+		Labels:    labels,
+		Timestamp: entry.Time.UnixNano(),
+		Line:      string(encodedLine),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.batcher.add(item)
+
+	return nil
+}
+
+// send groups the batched entries by stream and posts them
+func (s *LokiSink) send(ctx context.Context, batch [][]byte) error {
+	streams, err := lokiStreams(batch)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	if s.config.Encoding == LokiEncodingJSON {
+		payload, err = lokiRequestJSON(streams)
+		if err != nil {
+			return err
+		}
+	} else {
+		payload = snappyEncode(lokiRequestProto(streams))
+	}
+
+	return s.shipper.post(ctx, s.config.Endpoint, s.header, payload, len(batch))
+}
+
+// lokiStreams decodes the batched entries and groups them by labels, keeping the order of arrival
+func lokiStreams(batch [][]byte) ([]*lokiStream, error) {
+	var streams []*lokiStream
+	byLabels := make(map[string]*lokiStream)
+
+	for _, item := range batch {
+		var entry lokiEntry
+		if err := json.Unmarshal(item, &entry); err != nil {
+			return nil, err
+		}
+
+		key := lokiLabelsString(entry.Labels)
+
+		stream, ok := byLabels[key]
+		if !ok {
+			stream = &lokiStream{labels: entry.Labels}
+			byLabels[key] = stream
+			streams = append(streams, stream)
+		}
+
+		stream.entries = append(stream.entries, entry)
+	}
+
+	return streams, nil
+}
+
+// lokiRequestJSON encodes the streams as a JSON push request
+func lokiRequestJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	request := struct {
+		Streams []jsonStream `json:"streams"`
+	}{
+		Streams: make([]jsonStream, 0, len(streams)),
+	}
+
+	for _, stream := range streams {
+		values := make([][2]string, 0, len(stream.entries))
+		for _, entry := range stream.entries {
+			values = append(values, [2]string{strconv.FormatInt(entry.Timestamp, 10), entry.Line})
+		}
+
+		request.Streams = append(request.Streams, jsonStream{Stream: stream.labels, Values: values})
+	}
+
+	return json.Marshal(request)
+}
+
+// Loki protobuf field numbers
+const (
+	lokiRequestStreams = 1
+
+	lokiStreamLabels  = 1
+	lokiStreamEntries = 2
+
+	lokiEntryTimestamp = 1
+	lokiEntryLine      = 2
+
+	lokiTimestampSeconds = 1
+	lokiTimestampNanos   = 2
+)
+
+// lokiRequestProto encodes the streams as a logproto.PushRequest
+func lokiRequestProto(streams []*lokiStream) []byte {
+	var request protoBuffer
+
+	for _, stream := range streams {
+		var streamMsg protoBuffer
+		streamMsg.string(lokiStreamLabels, lokiLabelsString(stream.labels))
+
+		for _, entry := range stream.entries {
+			var timestamp protoBuffer
+			timestamp.varint(lokiTimestampSeconds, entry.Timestamp/1e9)
+			timestamp.varint(lokiTimestampNanos, entry.Timestamp%1e9)
+
+			var entryMsg protoBuffer
+			entryMsg.bytes(lokiEntryTimestamp, timestamp.Bytes())
+			entryMsg.string(lokiEntryLine, entry.Line)
+
+			streamMsg.bytes(lokiStreamEntries, entryMsg.Bytes())
+		}
+
+		request.bytes(lokiRequestStreams, streamMsg.Bytes())
+	}
+
+	return request.Bytes()
+}
+
+// lokiLabelsString returns the labels sorted by name in the Prometheus format, e.g. {level="info", service="api"}
+func lokiLabelsString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(labels[name]))
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// lokiLabelName replaces the characters not allowed in a label name with underscores, e.g. http.port is http_port
+func lokiLabelName(field string) string {
+	name := []byte(field)
+
+	for i, c := range name {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')
+		if !valid {
+			name[i] = '_'
+		}
+	}
+
+	return string(name)
+}
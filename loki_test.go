@@ -0,0 +1,286 @@
+package logpet
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// lokiReceivedEntry is an entry decoded by lokiStandIn
+type lokiReceivedEntry struct {
+	timestamp time.Time
+	line      map[string]interface{}
+}
+
+// lokiStandIn is a local push API decoding the received streams in both encodings
+type lokiStandIn struct {
+	mu      sync.Mutex
+	tenant  string
+	streams map[string][]lokiReceivedEntry
+}
+
+func (c *lokiStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.tenant = r.Header.Get("X-Scope-OrgID")
+
+	switch r.Header.Get("Content-Type") {
+	case "application/json":
+		err = c.decodeJSON(body)
+	case "application/x-protobuf":
+		var request []byte
+		if request, err = snappyDecodeLiterals(body); err == nil {
+			err = c.decodeProto(request)
+		}
+	default:
+		err = fmt.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *lokiStandIn) add(labels string, timestamp time.Time, line string) error {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+		return err
+	}
+
+	if c.streams == nil {
+		c.streams = make(map[string][]lokiReceivedEntry)
+	}
+	c.streams[labels] = append(c.streams[labels], lokiReceivedEntry{timestamp: timestamp, line: decoded})
+
+	return nil
+}
+
+func (c *lokiStandIn) decodeJSON(body []byte) error {
+	var request struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return err
+	}
+
+	for _, stream := range request.Streams {
+		for _, value := range stream.Values {
+			nanos, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				return err
+			}
+
+			if err := c.add(lokiLabelsString(stream.Stream), time.Unix(0, nanos), value[1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *lokiStandIn) decodeProto(body []byte) error {
+	request, err := protoFields(body)
+	if err != nil {
+		return err
+	}
+
+	for _, streamMsg := range request[lokiRequestStreams] {
+		stream, err := protoFields(streamMsg.([]byte))
+		if err != nil {
+			return err
+		}
+
+		labels := string(stream[lokiStreamLabels][0].([]byte))
+
+		for _, entryMsg := range stream[lokiStreamEntries] {
+			entry, err := protoFields(entryMsg.([]byte))
+			if err != nil {
+				return err
+			}
+
+			timestamp, err := protoFields(entry[lokiEntryTimestamp][0].([]byte))
+			if err != nil {
+				return err
+			}
+
+			var seconds, nanos int64
+			if values := timestamp[lokiTimestampSeconds]; values != nil {
+				seconds = int64(values[0].(uint64))
+			}
+			if values := timestamp[lokiTimestampNanos]; values != nil {
+				nanos = int64(values[0].(uint64))
+			}
+
+			if err := c.add(labels, time.Unix(seconds, nanos), string(entry[lokiEntryLine][0].([]byte))); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// snappyDecodeLiterals decodes a snappy block made of literals only, as written by snappyEncode
+func snappyDecodeLiterals(block []byte) ([]byte, error) {
+	length, n := binary.Uvarint(block)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid snappy preamble")
+	}
+	block = block[n:]
+
+	decoded := make([]byte, 0, length)
+	for len(block) > 0 {
+		tag := block[0]
+		block = block[1:]
+
+		if tag&3 != 0 {
+			return nil, fmt.Errorf("unexpected snappy copy tag %x", tag)
+		}
+
+		// the length minus one is inline up to 59, or in the following 1 to 4 bytes
+		literal := int(tag >> 2)
+		if extra := literal - 59; extra > 0 {
+			if len(block) < extra {
+				return nil, fmt.Errorf("truncated snappy literal length")
+			}
+
+			literal = 0
+			for i := extra - 1; i >= 0; i-- {
+				literal = literal<<8 | int(block[i])
+			}
+			block = block[extra:]
+		}
+		literal++
+
+		if len(block) < literal {
+			return nil, fmt.Errorf("truncated snappy literal")
+		}
+
+		decoded = append(decoded, block[:literal]...)
+		block = block[literal:]
+	}
+
+	if uint64(len(decoded)) != length {
+		return nil, fmt.Errorf("decoded %d bytes, the preamble says %d", len(decoded), length)
+	}
+
+	return decoded, nil
+}
+
+func TestSnappyEncodeLiterals(t *testing.T) {
+	// inline, one byte and two bytes literal lengths, and more literals than one
+	for _, size := range []int{1, 60, 61, 256, 257, snappyMaxLiteralLength, snappyMaxLiteralLength + 300} {
+		src := []byte(strings.Repeat("logpet", size)[:size])
+
+		decoded, err := snappyDecodeLiterals(snappyEncode(src))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if string(decoded) != string(src) {
+			t.Errorf("%d bytes: decoded a different block", size)
+		}
+	}
+}
+
+func TestLokiSinkPushesStreams(t *testing.T) {
+	for _, encoding := range []string{LokiEncodingProtobuf, LokiEncodingJSON} {
+		t.Run(encoding, func(t *testing.T) {
+			loki := &lokiStandIn{}
+			server := httptest.NewServer(loki)
+			defer server.Close()
+
+			sink, err := NewLokiSink(LokiConfig{
+				Endpoint:     server.URL + "/loki/api/v1/push",
+				Encoding:     encoding,
+				Labels:       []string{LokiLevelLabel, "http.method"},
+				StaticLabels: map[string]string{"env": "test"},
+				TenantID:     "tenant",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l := newLocalLogger(t)
+			l.AddSink(sink, logrus.TraceLevel, nil)
+
+			// larger than a snappy literal
+			long := strings.Repeat("x", snappyMaxLiteralLength+100)
+
+			before := time.Now()
+			l.SendInfoLog("first", map[string]interface{}{"http.method": "GET", "attempt": 1})
+			l.SendWarnLog("second", map[string]interface{}{"http.method": "GET"})
+			l.SendInfoLog("third", map[string]interface{}{"http.method": "GET", "body": long})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := l.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+			after := time.Now()
+
+			loki.mu.Lock()
+			defer loki.mu.Unlock()
+
+			if loki.tenant != "tenant" {
+				t.Errorf("the tenant is %q, want tenant", loki.tenant)
+			}
+
+			info := fmt.Sprintf(`{env="test", http_method="GET", level=%q}`, levelName(logrus.InfoLevel))
+			warn := fmt.Sprintf(`{env="test", http_method="GET", level=%q}`, levelName(logrus.WarnLevel))
+
+			if len(loki.streams) != 2 || len(loki.streams[info]) != 2 || len(loki.streams[warn]) != 1 {
+				t.Fatalf("received the streams %v, want %s with 2 entries and %s with 1", loki.streams, info, warn)
+			}
+
+			first, third := loki.streams[info][0], loki.streams[info][1]
+
+			if first.line["message"] != "first" || first.line["attempt"] != float64(1) {
+				t.Errorf("the first line is %v", first.line)
+			}
+
+			if _, ok := first.line["http.method"]; ok {
+				t.Errorf("the label field is repeated in the line %v", first.line)
+			}
+
+			if third.line["message"] != "third" || third.line["body"] != long {
+				t.Error("the third line isn't the long one")
+			}
+
+			if loki.streams[warn][0].line["message"] != "second" {
+				t.Errorf("the warning line is %v", loki.streams[warn][0].line)
+			}
+
+			if first.timestamp.Before(before) || first.timestamp.After(after) || third.timestamp.Before(first.timestamp) {
+				t.Errorf("the timestamps %v and %v aren't between %v and %v", first.timestamp, third.timestamp, before, after)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package logpet
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons a log is dropped, used as keys of Stats.Dropped
+const (
+	DropReasonOverflowNewest = "overflow_newest"
+	DropReasonOverflowOldest = "overflow_oldest"
+	DropReasonOverflowLevel  = "overflow_level"
+	DropReasonClosed         = "closed"
+	DropReasonSendFailed     = "send_failed"
+	DropReasonBacklog        = "backlog"
+	DropReasonSpoolFailed    = "spool_failed"
+	DropReasonSpoolFull      = "spool_full"
+	DropReasonStale          = "stale"
+	DropReasonShutdown       = "shutdown"
+	DropReasonSampled        = "sampled"
+	DropReasonRateLimited    = "rate_limited"
+)
+
+// Stats is a snapshot of the counters and gauges of the logging pipeline.
+type Stats struct {
+	Enqueued  int64
+	Sent      int64
+	SentBytes int64
+	Failed    int64
+	Retried   int64
+	Spooled   int64
+	Replayed  int64
+	// Dropped counts the discarded logs by reason.
+	Dropped       map[string]int64
+	QueueDepth    int
+	QueueCapacity int
+	// LastSuccess is the time of the last successful send, zero if nothing was sent yet.
+	LastSuccess time.Time
+}
+
+// TotalDropped returns the number of discarded logs whatever the reason
+func (s Stats) TotalDropped() int64 {
+	var total int64
+	for _, count := range s.Dropped {
+		total += count
+	}
+
+	return total
+}
+
+// pipelineMetrics holds the counters updated by the pipeline, accessed atomically
+type pipelineMetrics struct {
+	enqueued           int64
+	sent               int64
+	sentBytes          int64
+	failed             int64
+	retried            int64
+	spooled            int64
+	replayed           int64
+	droppedSendFailed  int64
+	droppedBacklog     int64
+	droppedSpoolFailed int64
+	droppedSpoolFull   int64
+	droppedStale       int64
+	droppedShutdown    int64
+	droppedSampled     int64
+	droppedRateLimited int64
+	lastSuccess        int64
+}
+
+// recordSent counts the logs accepted by a destination along with the bytes sent
+func (m *pipelineMetrics) recordSent(entries, bytes int) {
+	atomic.AddInt64(&m.sent, int64(entries))
+	atomic.AddInt64(&m.sentBytes, int64(bytes))
+	atomic.StoreInt64(&m.lastSuccess, time.Now().UnixNano())
+}
+
+// Stats returns a snapshot of the counters and gauges of the logging pipeline
+func (l *StandardLogger) Stats() Stats {
+	m := &l.metrics
+
+	stats := Stats{
+		Enqueued:  atomic.LoadInt64(&m.enqueued),
+		Sent:      atomic.LoadInt64(&m.sent),
+		SentBytes: atomic.LoadInt64(&m.sentBytes),
+		Failed:    atomic.LoadInt64(&m.failed),
+		Retried:   atomic.LoadInt64(&m.retried),
+		Spooled:   atomic.LoadInt64(&m.spooled),
+		Replayed:  atomic.LoadInt64(&m.replayed),
+		Dropped: map[string]int64{
+			DropReasonSendFailed:  atomic.LoadInt64(&m.droppedSendFailed),
+			DropReasonBacklog:     atomic.LoadInt64(&m.droppedBacklog),
+			DropReasonSpoolFailed: atomic.LoadInt64(&m.droppedSpoolFailed),
+			DropReasonSpoolFull:   atomic.LoadInt64(&m.droppedSpoolFull),
+			DropReasonStale:       atomic.LoadInt64(&m.droppedStale),
+			DropReasonShutdown:    atomic.LoadInt64(&m.droppedShutdown),
+			DropReasonSampled:     atomic.LoadInt64(&m.droppedSampled),
+			DropReasonRateLimited: atomic.LoadInt64(&m.droppedRateLimited),
+		},
+	}
+
+	if lastSuccess := atomic.LoadInt64(&m.lastSuccess); lastSuccess > 0 {
+		stats.LastSuccess = time.Unix(0, lastSuccess)
+	}
+
+	queueStats := l.QueueStats()
+	stats.QueueDepth = queueStats.Depth
+	stats.QueueCapacity = queueStats.Capacity
+	stats.Dropped[DropReasonOverflowNewest] = queueStats.DroppedNewest
+	stats.Dropped[DropReasonOverflowOldest] = queueStats.DroppedOldest
+	stats.Dropped[DropReasonOverflowLevel] = queueStats.DroppedByLevel
+	stats.Dropped[DropReasonClosed] = queueStats.DroppedClosed
+
+	return stats
+}
+
+// PublishExpvar publishes the pipeline stats as an expvar variable with the provided name.
+// Like expvar.Publish it panics if the name is already in use.
+func (l *StandardLogger) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return l.Stats()
+	}))
+}
+
+// MetricsHandler returns an http.Handler exposing the pipeline stats in the Prometheus text format
+func (l *StandardLogger) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := l.Stats()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		writeMetric(w, "logpet_entries_enqueued_total", "counter", "Logs accepted by the queue.", stats.Enqueued)
+		writeMetric(w, "logpet_entries_sent_total", "counter", "Logs accepted by a destination.", stats.Sent)
+		writeMetric(w, "logpet_sent_bytes_total", "counter", "Bytes sent to the destinations.", stats.SentBytes)
+		writeMetric(w, "logpet_entries_failed_total", "counter", "Logs a destination failed to accept.", stats.Failed)
+		writeMetric(w, "logpet_requests_retried_total", "counter", "Requests sent again after a failure.", stats.Retried)
+		writeMetric(w, "logpet_entries_spooled_total", "counter", "Logs saved offline.", stats.Spooled)
+		writeMetric(w, "logpet_entries_replayed_total", "counter", "Offline logs sent again.", stats.Replayed)
+
+		reasons := make([]string, 0, len(stats.Dropped))
+		for reason := range stats.Dropped {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+
+		fmt.Fprintln(w, "# HELP logpet_entries_dropped_total Logs discarded by the pipeline.")
+		fmt.Fprintln(w, "# TYPE logpet_entries_dropped_total counter")
+		for _, reason := range reasons {
+			fmt.Fprintf(w, "logpet_entries_dropped_total{reason=%q} %d\n", reason, stats.Dropped[reason])
+		}
+
+		writeMetric(w, "logpet_queue_depth", "gauge", "Logs waiting in the queue.", int64(stats.QueueDepth))
+		writeMetric(w, "logpet_queue_capacity", "gauge", "Maximum number of logs in the queue.", int64(stats.QueueCapacity))
+
+		var lastSuccess int64
+		if !stats.LastSuccess.IsZero() {
+			lastSuccess = stats.LastSuccess.Unix()
+		}
+		writeMetric(w, "logpet_last_success_timestamp_seconds", "gauge", "Unix time of the last successful send.", lastSuccess)
+	})
+}
+
+// writeMetric writes a single metric without labels in the Prometheus text format
+func writeMetric(w io.Writer, name, metricType, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
@@ -1,106 +1,275 @@
 package logpet
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Attributes added to the logs sent again by SendOfflineLogs
+const (
+	// ReplayedField is true on the logs sent again by SendOfflineLogs.
+	ReplayedField = "replayed"
+	// OfflineTimestampField carries the original time of the logs older than DataDogMaxLogAge,
+	// which are sent with the time they are replayed.
+	OfflineTimestampField = "offline.timestamp"
+)
+
+// StaleOfflineLogPolicy selects what happens to the offline logs older than DataDogMaxLogAge,
+// whose original time would be rejected by the DataDog intake.
+type StaleOfflineLogPolicy int
+
+const (
+	// StaleOfflineLogsRestamp sends them with the time they are replayed and the original one as OfflineTimestampField.
+	StaleOfflineLogsRestamp StaleOfflineLogPolicy = iota
+	// StaleOfflineLogsDrop discards them.
+	StaleOfflineLogsDrop
 )
 
 func (l *StandardLogger) EnableOfflineLogs(enable bool) {
 	l.saveOfflineLogs = enable
 }
 
-func (l *StandardLogger) saveLogToFile(toSave []byte, filename string) error {
+// SetStaleOfflineLogPolicy sets what SendOfflineLogs does with the logs older than DataDogMaxLogAge
+func (l *StandardLogger) SetStaleOfflineLogPolicy(policy StaleOfflineLogPolicy) {
+	l.staleOfflinePolicy = policy
+}
+
+// errQueueClosed is returned when the replayed logs can't be queued because the logger is closed
+var errQueueClosed = errors.New("the log queue is closed")
 
-	_, err := os.Stat(l.offlineLogsPath)
-	if os.IsNotExist(err) {
-		err = os.Mkdir(l.offlineLogsPath, 0644)
-		if err != nil {
-			return err
-		}
+// spoolLogs appends the encoded logs to the offline logs spool
+func (l *StandardLogger) spoolLogs(logs [][]byte) {
+	s, err := l.offlineSpool()
+	if err != nil {
+		atomic.AddInt64(&l.metrics.droppedSpoolFailed, int64(len(logs)))
+		log.Printf("unable to save logs offline, %v", err)
+		return
 	}
 
-	filename = strings.ReplaceAll(filename, ":", "-")
+	s.appendCounting(logs, &l.metrics)
+}
 
-	filename = filepath.Join(l.offlineLogsPath, filename)
+// SendOfflineLogs sends again the logs saved offline, segment by segment from the oldest one,
+// only to the destination that failed to ship them. A segment is removed once its logs have been
+// flushed, the logs saved offline again while sending are kept for the next call.
+func (l *StandardLogger) SendOfflineLogs() error {
 
-	_, err = os.Stat(filename)
-	if os.IsNotExist(err) {
-		_, err := os.Create(filename)
-		if err != nil {
-			return err
-		}
+	dir, err := ioutil.ReadDir(l.offlineLogsPath)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to open directory %s, %v", l.offlineLogsPath, err))
 	}
 
-	err = ioutil.WriteFile(filename, toSave, 0644)
+	s, err := l.offlineSpool()
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-func (l *StandardLogger) SendOfflineLogs() error {
+	for _, segment := range s.rotate() {
+		if err := l.sendOfflineSegment(segment); err != nil {
+			l.SendErrfLog("unable to send offline logs %s, due to %v", nil, filepath.Base(segment), err)
+			continue
+		}
 
-	dir, err := ioutil.ReadDir(l.offlineLogsPath)
-	if err != nil {
-		return errors.New(fmt.Sprintf("unable to open directory %s, %v", l.offlineLogsPath, err))
+		// the segment is removed once its logs have been shipped, the ones failing again
+		// are already saved in a new segment or dropped for good
+		_ = l.flushDataDogRoute(context.Background())
+
+		if err := s.remove(segment); err != nil {
+			l.SendErrfLog("unable to remove file %s due to %v", nil, filepath.Base(segment), err)
+		}
 	}
 
+	// the sinks keeping their own offline logs send them again to their destination only
+	for _, route := range l.routes() {
+		if replayer, ok := route.sink.(offlineReplayer); ok {
+			if err := replayer.sendOfflineLogs(context.Background()); err != nil {
+				l.SendErrfLog("unable to send the offline logs of %T, due to %v", nil, route.sink, err)
+			}
+		}
+	}
+
+	// files saved one per log by previous versions, removed once their logs have been shipped
+	var sent []string
 	for _, logfile := range dir {
 		if strings.HasPrefix(logfile.Name(), "log-") {
 
 			filename := filepath.Join(l.offlineLogsPath, logfile.Name())
 
-			// read and send
-			file, err := os.Open(filename)
+			content, err := ioutil.ReadFile(filename)
 			if err != nil {
 				l.SendErrfLog("unable to open file %s", nil, logfile.Name())
 				continue
 			}
 
-			var logs ClientLog
-
-			err = json.NewDecoder(file).Decode(&logs)
-			if err != nil {
-				l.SendErrfLog("error decoding json log %s, due to %v", nil, file.Name(), err)
-
-				// Close file and handle err
-				err = file.Close()
-				if err != nil {
-					l.SendErrfLog("error closing json log %s, due to %v", nil, file.Name(), err)
-				}
+			if err := l.sendOfflineLog(content); err != nil {
+				l.SendErrfLog("error decoding json log %s, due to %v", nil, logfile.Name(), err)
 				continue
 			}
 
-			switch logs.Level {
-			case "info":
-				l.SendInfoLog(logs.Message, nil)
-			case "warning":
-				l.SendWarnLog(logs.Message, nil)
-			case "error":
-				l.SendErrLog(logs.Message, nil)
-			case "debug":
-				l.SendDebugLog(logs.Message, nil)
-			case "fatal":
-				l.SendErrfLog("EX FATAL | %s", nil, logs.Message)
-			}
+			sent = append(sent, filename)
+		}
+	}
 
-			// Close file and handle err
-			err = file.Close()
-			if err != nil {
-				l.SendErrfLog("unable to close file %s due to %v", nil, file.Name(), err)
-			}
+	if len(sent) > 0 {
+		_ = l.flushDataDogRoute(context.Background())
+	}
 
-			err = os.Remove(filename)
-			if err != nil {
-				l.SendErrfLog("unable to remove file %s due to %v", nil, file.Name(), err)
-			}
+	for _, filename := range sent {
+		if err := os.Remove(filename); err != nil {
+			l.SendErrfLog("unable to remove file %s due to %v", nil, filepath.Base(filename), err)
+		}
+	}
+
+	return nil
+}
+
+// sendOfflineSegment sends every log of the segment, the lines that can't be decoded are reported and skipped.
+// It fails if the logs can't be queued anymore.
+func (l *StandardLogger) sendOfflineSegment(segment string) error {
+	var queueErr error
+
+	err := readSegment(segment, func(line []byte, lineNumber int) {
+		if queueErr != nil {
+			return
+		}
+
+		if err := l.sendOfflineLog(line); err == errQueueClosed {
+			queueErr = err
+		} else if err != nil {
+			l.SendErrfLog("error decoding json log %s:%d, due to %v", nil, filepath.Base(segment), lineNumber, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return queueErr
+}
+
+// flushDataDogRoute waits for the queued logs to be handled and the DataDog route to ship them
+func (l *StandardLogger) flushDataDogRoute(ctx context.Context) error {
+	if err := l.waitIdle(ctx); err != nil {
+		return err
+	}
+
+	for _, route := range l.dataDogRoutes() {
+		if err := route.sink.Flush(ctx); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// sendOfflineLog decodes a log saved offline and sends it again with its level, time and attributes
+func (l *StandardLogger) sendOfflineLog(data []byte) error {
+	logElem, err := l.decodeOfflineLog(data)
+	if err != nil {
+		return err
+	}
+
+	logElem.CustomFields[ReplayedField] = true
+
+	if time.Since(logElem.Time) > DataDogMaxLogAge {
+		if l.staleOfflinePolicy == StaleOfflineLogsDrop {
+			atomic.AddInt64(&l.metrics.droppedStale, 1)
+			return nil
+		}
+
+		logElem.CustomFields[OfflineTimestampField] = logElem.Time.Format(time.RFC3339Nano)
+		logElem.Time = time.Time{}
+	}
+
+	// the log was sampled and deduplicated when it was sent the first time,
+	// the other sinks received it then
+	logElem.dataDogOnly = true
+	if !l.push(logElem, true) {
+		return errQueueClosed
+	}
+
+	atomic.AddInt64(&l.metrics.replayed, 1)
+
+	return nil
+}
+
+// decodeOfflineLog decodes a log encoded by the JSON formatter of the logger, the time, level
+// and message keys are read from its field map and the other keys are the custom fields
+func (l *StandardLogger) decodeOfflineLog(data []byte) (Log, error) {
+	timeKey, levelKey, messageKey := "date", "status", "message"
+	timestampFormat := time.RFC3339
+	dataKey := ""
+
+	if formatter, ok := l.Formatter.(*logrus.JSONFormatter); ok {
+		timeKey = logfmtKey(formatter.FieldMap[logrus.FieldKeyTime], logrus.FieldKeyTime)
+		levelKey = logfmtKey(formatter.FieldMap[logrus.FieldKeyLevel], logrus.FieldKeyLevel)
+		messageKey = logfmtKey(formatter.FieldMap[logrus.FieldKeyMsg], logrus.FieldKeyMsg)
+		timestampFormat = logfmtKey(formatter.TimestampFormat, time.RFC3339)
+		dataKey = formatter.DataKey
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return Log{}, err
+	}
+
+	logElem := Log{Level: logrus.InfoLevel, CustomFields: make(map[string]interface{}, len(fields))}
+
+	if message, ok := fields[messageKey].(string); ok {
+		logElem.Message = message
+	}
+
+	if status, ok := fields[levelKey].(string); ok {
+		level, err := logrus.ParseLevel(status)
+		if err != nil {
+			return Log{}, err
+		}
+		logElem.Level = level
+	}
+
+	if date, ok := fields[timeKey].(string); ok {
+		if t, err := time.Parse(timestampFormat, date); err == nil {
+			logElem.Time = t
+		}
+	}
+
+	// the custom fields are nested when the formatter has a data key
+	if nested, ok := fields[dataKey].(map[string]interface{}); ok && dataKey != "" {
+		delete(fields, dataKey)
+		for key, value := range nested {
+			fields[key] = value
+		}
+	}
+
+	for key, value := range fields {
+		switch key {
+		case timeKey, levelKey, messageKey, logrus.FieldKeyLogrusError:
+			continue
+		case "fields." + timeKey, "fields." + levelKey, "fields." + messageKey:
+			// custom fields clashing with the time, level and message keys are prefixed by the formatter
+			key = strings.TrimPrefix(key, "fields.")
+		}
+
+		logElem.CustomFields[key] = normalizeDecoded(value)
+	}
+
+	if logElem.Time.IsZero() {
+		logElem.Time = time.Now()
+	}
+
+	return logElem, nil
+}
@@ -0,0 +1,299 @@
+package logpet
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ddStandIn is a local DataDog intake failing with 503 while down
+type ddStandIn struct {
+	mu   sync.Mutex
+	down bool
+	logs []map[string]interface{}
+}
+
+func (c *ddStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == CompressionGzip {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = reader
+	}
+
+	var logs []map[string]interface{}
+	if err := json.NewDecoder(body).Decode(&logs); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.logs = append(c.logs, logs...)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// newOfflineLogger returns a logger shipping to the intake and to a file sink, with offline logs in dir
+func newOfflineLogger(t *testing.T, endpoint, dir string) (*StandardLogger, *syncBuffer) {
+	l := NewLogger()
+	l.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+	if err := l.SetupDataDogLogger(endpoint, "api-key", dir, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &syncBuffer{}
+	l.AddSink(NewWriterSink(file), logrus.TraceLevel, nil)
+
+	return l, file
+}
+
+func TestSendOfflineLogsReplaysOnlyToDataDog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logpet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	intake := &ddStandIn{down: true}
+	server := httptest.NewServer(intake)
+	defer server.Close()
+
+	l, file := newOfflineLogger(t, server.URL, dir)
+
+	sent := time.Now().Truncate(time.Second)
+
+	l.SendErrLog("first", map[string]interface{}{"order.id": "42"})
+	l.SendErrLog("second", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the error of the failed batch is expected
+	_ = l.Flush(ctx)
+
+	if spooled := l.Stats().Spooled; spooled != 2 {
+		t.Fatalf("spooled %d logs, want 2", spooled)
+	}
+
+	intake.mu.Lock()
+	intake.down = false
+	intake.mu.Unlock()
+
+	if err := l.SendOfflineLogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the logs are shipped before SendOfflineLogs returns
+	intake.mu.Lock()
+	received := len(intake.logs)
+	for _, log := range intake.logs {
+		if log[ReplayedField] != true {
+			t.Errorf("the log %v isn't marked as replayed", log)
+		}
+
+		if log["status"] != "error" {
+			t.Errorf("the log %v was replayed with the status %v, want error", log, log["status"])
+		}
+
+		// the original time is kept
+		date, err := time.Parse(time.RFC3339, fmt.Sprint(log["date"]))
+		if err != nil || date.Before(sent) || date.After(sent.Add(5*time.Second)) {
+			t.Errorf("the log %v was replayed with the date %v, want the time it was sent", log, log["date"])
+		}
+	}
+
+	if received == 2 && (intake.logs[0]["message"] != "first" || intake.logs[0]["order.id"] != "42") {
+		t.Errorf("the first log was replayed as %v, want its message and custom field", intake.logs[0])
+	}
+	intake.mu.Unlock()
+
+	if received != 2 {
+		t.Errorf("the intake received %d logs, want 2", received)
+	}
+
+	if replayed := l.Stats().Replayed; replayed != 2 {
+		t.Errorf("replayed %d logs, want 2", replayed)
+	}
+
+	if err := l.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := file.lines(); lines != 2 {
+		t.Errorf("the file sink received %d lines, want only the 2 original logs", lines)
+	}
+
+	if segments, _ := filepath.Glob(filepath.Join(dir, spoolSegmentPrefix+"*")); len(segments) != 0 {
+		t.Errorf("the replayed segments weren't removed, %v", segments)
+	}
+}
+
+func TestSendOfflineLogsStaleLogs(t *testing.T) {
+	for _, policy := range []StaleOfflineLogPolicy{StaleOfflineLogsRestamp, StaleOfflineLogsDrop} {
+		name := "restamp"
+		if policy == StaleOfflineLogsDrop {
+			name = "drop"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "logpet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			intake := &ddStandIn{}
+			server := httptest.NewServer(intake)
+			defer server.Close()
+
+			// a segment saved by a previous run older than DataDogMaxLogAge
+			original := time.Now().Add(-DataDogMaxLogAge - time.Hour).Truncate(time.Second)
+			line := fmt.Sprintf(`{"date":%q,"status":"warning","message":"stale","order.id":"42"}`+"\n", original.Format(time.RFC3339))
+			if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf(spoolSegmentFormat, 1)), []byte(line), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			l, _ := newOfflineLogger(t, server.URL, dir)
+			l.SetStaleOfflineLogPolicy(policy)
+
+			replayedAt := time.Now().Truncate(time.Second)
+
+			if err := l.SendOfflineLogs(); err != nil {
+				t.Fatal(err)
+			}
+
+			stats := l.Stats()
+
+			intake.mu.Lock()
+			defer intake.mu.Unlock()
+
+			if policy == StaleOfflineLogsDrop {
+				if len(intake.logs) != 0 || stats.Dropped[DropReasonStale] != 1 || stats.Replayed != 0 {
+					t.Errorf("the intake received %v, dropped %d stale logs and replayed %d, want only the stale log dropped",
+						intake.logs, stats.Dropped[DropReasonStale], stats.Replayed)
+				}
+			} else {
+				if len(intake.logs) != 1 || stats.Replayed != 1 {
+					t.Fatalf("the intake received %v and replayed %d, want the stale log", intake.logs, stats.Replayed)
+				}
+
+				log := intake.logs[0]
+
+				date, err := time.Parse(time.RFC3339, fmt.Sprint(log["date"]))
+				if err != nil || date.Before(replayedAt) {
+					t.Errorf("the stale log was replayed with the date %v, want the time of the replay", log["date"])
+				}
+
+				offline, err := time.Parse(time.RFC3339Nano, fmt.Sprint(log[OfflineTimestampField]))
+				if err != nil || !offline.Equal(original) {
+					t.Errorf("the original time is %v, want %v", log[OfflineTimestampField], original)
+				}
+
+				if log["status"] != "warning" || log["message"] != "stale" || log["order.id"] != "42" {
+					t.Errorf("the stale log was replayed as %v", log)
+				}
+			}
+
+			if segments, _ := filepath.Glob(filepath.Join(dir, spoolSegmentPrefix+"*")); len(segments) != 0 {
+				t.Errorf("the replayed segments weren't removed, %v", segments)
+			}
+		})
+	}
+}
+
+func TestSendOfflineLogsKeepsLogsNotQueued(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logpet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	intake := &ddStandIn{down: true}
+	server := httptest.NewServer(intake)
+	defer server.Close()
+
+	l, _ := newOfflineLogger(t, server.URL, dir)
+
+	l.SendErrLog("first", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the logs saved offline can't be queued anymore once closed
+	_, _ = l.Close(ctx)
+
+	if err := l.SendOfflineLogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	if replayed := l.Stats().Replayed; replayed != 0 {
+		t.Errorf("replayed %d logs after Close, want 0", replayed)
+	}
+
+	if segments, _ := filepath.Glob(filepath.Join(dir, spoolSegmentPrefix+"*")); len(segments) != 1 {
+		t.Errorf("found %d segments, want the one that couldn't be replayed", len(segments))
+	}
+}
+
+func TestSpoolErrorsAreNotWrittenToStdout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logpet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a file where the spool directory should be
+	path := filepath.Join(dir, "offline")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLogger()
+	l.offlineLogsPath = path
+	l.EnableOfflineLogs(true)
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	l.spoolLogs([][]byte{[]byte(`{"message":"lost"}`)})
+	os.Stdout = stdout
+	writer.Close()
+
+	written, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(written) != 0 {
+		t.Errorf("the spool error was written to stdout: %s", written)
+	}
+
+	if failed := l.Stats().Dropped[DropReasonSpoolFailed]; failed != 1 {
+		t.Errorf("dropped %d logs as spool_failed, want 1", failed)
+	}
+}
@@ -0,0 +1,403 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Encodings of the OTLP/HTTP requests
+const (
+	OTLPEncodingJSON     = "json"
+	OTLPEncodingProtobuf = "protobuf"
+)
+
+// OTLPConfig configures the OpenTelemetry OTLP/HTTP logs sink.
+type OTLPConfig struct {
+	// Endpoint is the URL of the logs endpoint, defaults to http://localhost:4318/v1/logs.
+	Endpoint string
+	// Encoding is OTLPEncodingJSON or OTLPEncodingProtobuf, defaults to protobuf.
+	Encoding string
+	// Headers are added to every request, e.g. for authentication.
+	Headers map[string]string
+	// HTTPClient defaults to a client with a 30 seconds timeout.
+	HTTPClient  *http.Client
+	Batch       BatchConfig
+	Retry       RetryPolicy
+	Compression Compression
+	// Service is sent as resource attributes, empty values are read from the DataDog environment variables.
+	Service ServiceInfo
+}
+
+// OTLPSink ships batches of entries to an OpenTelemetry collector with the OTLP/HTTP protocol.
+type OTLPSink struct {
+	batchedHTTPSink
+	config   OTLPConfig
+	header   http.Header
+	resource []otlpAttribute
+}
+
+// otlpAttribute is a key value pair with a value normalized by normalizeValue
+type otlpAttribute struct {
+	key   string
+	value interface{}
+}
+
+// NewOTLPSink returns a sink shipping entries to the OTLP/HTTP logs endpoint
+func NewOTLPSink(config OTLPConfig) (*OTLPSink, error) {
+	if config.Endpoint == "" {
+		config.Endpoint = defaultOTLPEndpoint
+	}
+
+	if config.Encoding == "" {
+		config.Encoding = OTLPEncodingProtobuf
+	}
+
+	if config.Encoding != OTLPEncodingJSON && config.Encoding != OTLPEncodingProtobuf {
+		return nil, fmt.Errorf("unsupported OTLP encoding %q", config.Encoding)
+	}
+
+	if err := config.Compression.validate(); err != nil {
+		return nil, err
+	}
+
+	config.Service = config.Service.withDefaults(serviceInfoFromEnv())
+
+	header := make(http.Header)
+	for key, value := range config.Headers {
+		header.Set(key, value)
+	}
+
+	if config.Encoding == OTLPEncodingJSON {
+		header.Set("Content-Type", "application/json")
+	} else {
+		header.Set("Content-Type", "application/x-protobuf")
+	}
+
+	sink := &OTLPSink{
+		batchedHTTPSink: newBatchedHTTPSink(config.HTTPClient, config.Retry, config.Compression),
+		config:          config,
+		header:          header,
+		resource:        otlpResource(config.Service),
+	}
+	sink.start(config.Batch, sink.send, nil)
+
+	return sink, nil
+}
+
+// Write encodes the entry as an OTLP log record and adds it to the current batch
+func (s *OTLPSink) Write(entry *logrus.Entry, formatted []byte) error {
+	attributes := otlpAttributes(entry.Data)
+
+	var record []byte
+	if s.config.Encoding == OTLPEncodingJSON {
+		record = otlpRecordJSON(entry, attributes)
+	} else {
+		record = otlpRecordProto(entry, attributes)
+	}
+
+	s.batcher.add(record)
+
+	return nil
+}
+
+// send wraps the encoded records in an export request and posts it
+func (s *OTLPSink) send(ctx context.Context, batch [][]byte) error {
+	var payload []byte
+	if s.config.Encoding == OTLPEncodingJSON {
+		payload = otlpRequestJSON(s.resource, batch)
+	} else {
+		payload = otlpRequestProto(s.resource, batch)
+	}
+
+	return s.shipper.post(ctx, s.config.Endpoint, s.header, payload, len(batch))
+}
+
+// otlpSeverity maps a logrus level to the OpenTelemetry severity number and text
+func otlpSeverity(level logrus.Level) (int, string) {
+	switch level {
+	case logrus.TraceLevel:
+		return 1, "TRACE"
+	case logrus.DebugLevel:
+		return 5, "DEBUG"
+	case logrus.InfoLevel:
+		return 9, "INFO"
+	case logrus.WarnLevel:
+		return 13, "WARN"
+	case logrus.ErrorLevel:
+		return 17, "ERROR"
+	case logrus.FatalLevel:
+		return 21, "FATAL"
+	default:
+		return 24, "FATAL4"
+	}
+}
+
+// otlpAttributes returns the entry fields sorted by key, without the service
+// metadata sent as resource attributes
+func otlpAttributes(data logrus.Fields) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(data))
+	for key, value := range data {
+		if serviceMetadataFields[key] {
+			continue
+		}
+
+		attributes = append(attributes, otlpAttribute{key: key, value: normalizeValue(value)})
+	}
+
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].key < attributes[j].key
+	})
+
+	return attributes
+}
+
+// otlpResource maps the service info to the OpenTelemetry semantic conventions
+func otlpResource(info ServiceInfo) []otlpAttribute {
+	var attributes []otlpAttribute
+
+	add := func(key, value string) {
+		if value != "" {
+			attributes = append(attributes, otlpAttribute{key: key, value: value})
+		}
+	}
+
+	add("service.name", info.Service)
+	add("service.version", info.Version)
+	add("deployment.environment", info.Env)
+	add("host.name", info.Hostname)
+
+	for _, tag := range info.Tags {
+		parts := strings.SplitN(tag, ":", 2)
+		if len(parts) == 2 {
+			add(parts[0], parts[1])
+		}
+	}
+
+	return attributes
+}
+
+// otlpRecordJSON encodes a LogRecord with the OTLP JSON encoding
+func otlpRecordJSON(entry *logrus.Entry, attributes []otlpAttribute) []byte {
+	severityNumber, severityText := otlpSeverity(entry.Level)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"timeUnixNano":"%d","observedTimeUnixNano":"%d","severityNumber":%d,"severityText":%q,"body":`,
+		entry.Time.UnixNano(), time.Now().UnixNano(), severityNumber, severityText)
+	writeOTLPValueJSON(&b, entry.Message)
+	b.WriteString(`,"attributes":`)
+	writeOTLPAttributesJSON(&b, attributes)
+	b.WriteByte('}')
+
+	return b.Bytes()
+}
+
+// otlpRequestJSON wraps the encoded records in an ExportLogsServiceRequest with the OTLP JSON encoding
+func otlpRequestJSON(resource []otlpAttribute, records [][]byte) []byte {
+	var b bytes.Buffer
+
+	b.WriteString(`{"resourceLogs":[{"resource":{"attributes":`)
+	writeOTLPAttributesJSON(&b, resource)
+	fmt.Fprintf(&b, `},"scopeLogs":[{"scope":{"name":%q},"logRecords":[`, otlpScopeNameValue)
+	b.Write(bytes.Join(records, []byte{','}))
+	b.WriteString(`]}]}]}`)
+
+	return b.Bytes()
+}
+
+func writeOTLPAttributesJSON(b *bytes.Buffer, attributes []otlpAttribute) {
+	b.WriteByte('[')
+	for i, attribute := range attributes {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"key":`)
+		writeJSONString(b, attribute.key)
+		b.WriteString(`,"value":`)
+		writeOTLPValueJSON(b, attribute.value)
+		b.WriteByte('}')
+	}
+	b.WriteByte(']')
+}
+
+// writeOTLPValueJSON encodes an AnyValue, int64 values are strings as required by the protobuf JSON mapping
+func writeOTLPValueJSON(b *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString(`{}`)
+	case string:
+		b.WriteString(`{"stringValue":`)
+		writeJSONString(b, v)
+		b.WriteByte('}')
+	case bool:
+		fmt.Fprintf(b, `{"boolValue":%t}`, v)
+	case int64:
+		fmt.Fprintf(b, `{"intValue":"%d"}`, v)
+	case float64:
+		fmt.Fprintf(b, `{"doubleValue":%s}`, strconv.FormatFloat(v, 'g', -1, 64))
+	case []interface{}:
+		b.WriteString(`{"arrayValue":{"values":[`)
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeOTLPValueJSON(b, item)
+		}
+		b.WriteString(`]}}`)
+	case map[string]interface{}:
+		b.WriteString(`{"kvlistValue":{"values":`)
+		writeOTLPAttributesJSON(b, sortedAttributes(v))
+		b.WriteString(`}}`)
+	default:
+		writeOTLPValueJSON(b, fmt.Sprint(v))
+	}
+}
+
+// OTLP protobuf field numbers
+const (
+	otlpRequestResourceLogs = 1
+
+	otlpResourceLogsResource  = 1
+	otlpResourceLogsScopeLogs = 2
+	otlpResourceAttributes    = 1
+
+	otlpScopeLogsScope      = 1
+	otlpScopeLogsLogRecords = 2
+	otlpScopeName           = 1
+
+	otlpRecordTimeUnixNano         = 1
+	otlpRecordSeverityNumber       = 2
+	otlpRecordSeverityText         = 3
+	otlpRecordBody                 = 5
+	otlpRecordAttributes           = 6
+	otlpRecordObservedTimeUnixNano = 11
+
+	otlpKeyValueKey   = 1
+	otlpKeyValueValue = 2
+
+	otlpValueString = 1
+	otlpValueBool   = 2
+	otlpValueInt    = 3
+	otlpValueDouble = 4
+	otlpValueArray  = 5
+	otlpValueKVList = 6
+
+	otlpListValues = 1
+)
+
+// otlpRecordProto encodes a LogRecord with the OTLP protobuf encoding
+func otlpRecordProto(entry *logrus.Entry, attributes []otlpAttribute) []byte {
+	severityNumber, severityText := otlpSeverity(entry.Level)
+
+	var record protoBuffer
+	record.fixed64(otlpRecordTimeUnixNano, uint64(entry.Time.UnixNano()))
+	record.uvarint(otlpRecordSeverityNumber, uint64(severityNumber))
+	record.string(otlpRecordSeverityText, severityText)
+	record.bytes(otlpRecordBody, otlpValueProto(entry.Message))
+	for _, attribute := range attributes {
+		record.bytes(otlpRecordAttributes, otlpKeyValueProto(attribute))
+	}
+	record.fixed64(otlpRecordObservedTimeUnixNano, uint64(time.Now().UnixNano()))
+
+	return record.Bytes()
+}
+
+// otlpRequestProto wraps the encoded records in an ExportLogsServiceRequest with the OTLP protobuf encoding
+func otlpRequestProto(resource []otlpAttribute, records [][]byte) []byte {
+	var resourceMsg protoBuffer
+	for _, attribute := range resource {
+		resourceMsg.bytes(otlpResourceAttributes, otlpKeyValueProto(attribute))
+	}
+
+	var scope protoBuffer
+	scope.string(otlpScopeName, otlpScopeNameValue)
+
+	var scopeLogs protoBuffer
+	scopeLogs.bytes(otlpScopeLogsScope, scope.Bytes())
+	for _, record := range records {
+		scopeLogs.bytes(otlpScopeLogsLogRecords, record)
+	}
+
+	var resourceLogs protoBuffer
+	resourceLogs.bytes(otlpResourceLogsResource, resourceMsg.Bytes())
+	resourceLogs.bytes(otlpResourceLogsScopeLogs, scopeLogs.Bytes())
+
+	var request protoBuffer
+	request.bytes(otlpRequestResourceLogs, resourceLogs.Bytes())
+
+	return request.Bytes()
+}
+
+func otlpKeyValueProto(attribute otlpAttribute) []byte {
+	var keyValue protoBuffer
+	keyValue.string(otlpKeyValueKey, attribute.key)
+	keyValue.bytes(otlpKeyValueValue, otlpValueProto(attribute.value))
+
+	return keyValue.Bytes()
+}
+
+// otlpValueProto encodes an AnyValue, the oneof fields are written even if zero
+func otlpValueProto(value interface{}) []byte {
+	var anyValue protoBuffer
+
+	switch v := value.(type) {
+	case nil:
+	case string:
+		anyValue.bytes(otlpValueString, []byte(v))
+	case bool:
+		var n uint64
+		if v {
+			n = 1
+		}
+		anyValue.writeUvarint(otlpValueBool, n)
+	case int64:
+		anyValue.writeUvarint(otlpValueInt, uint64(v))
+	case float64:
+		anyValue.writeFixed64(otlpValueDouble, math.Float64bits(v))
+	case []interface{}:
+		var list protoBuffer
+		for _, item := range v {
+			list.bytes(otlpListValues, otlpValueProto(item))
+		}
+		anyValue.bytes(otlpValueArray, list.Bytes())
+	case map[string]interface{}:
+		var list protoBuffer
+		for _, attribute := range sortedAttributes(v) {
+			list.bytes(otlpListValues, otlpKeyValueProto(attribute))
+		}
+		anyValue.bytes(otlpValueKVList, list.Bytes())
+	default:
+		anyValue.bytes(otlpValueString, []byte(fmt.Sprint(v)))
+	}
+
+	return anyValue.Bytes()
+}
+
+// sortedAttributes returns the normalized map entries sorted by key
+func sortedAttributes(values map[string]interface{}) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(values))
+	for key, value := range values {
+		attributes = append(attributes, otlpAttribute{key: key, value: value})
+	}
+
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].key < attributes[j].key
+	})
+
+	return attributes
+}
+
+// writeJSONString writes s as a JSON string
+func writeJSONString(b *bytes.Buffer, s string) {
+	encoded, _ := json.Marshal(s)
+	b.Write(encoded)
+}
@@ -0,0 +1,321 @@
+package logpet
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// otlpStandIn is a local collector decoding the received records in both encodings
+type otlpStandIn struct {
+	mu       sync.Mutex
+	failures int
+	records  []otlpDecodedRecord
+	resource map[string]interface{}
+}
+
+type otlpDecodedRecord struct {
+	timeUnixNano   uint64
+	severityNumber int
+	severityText   string
+	body           string
+	attributes     map[string]interface{}
+}
+
+func (c *otlpStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures > 0 {
+		c.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch r.Header.Get("Content-Type") {
+	case "application/json":
+		err = c.decodeJSON(body)
+	case "application/x-protobuf":
+		err = c.decodeProto(body)
+	default:
+		err = fmt.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *otlpStandIn) decodeJSON(body []byte) error {
+	type keyValue struct {
+		Key   string                     `json:"key"`
+		Value map[string]json.RawMessage `json:"value"`
+	}
+
+	var request struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []keyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano   string                     `json:"timeUnixNano"`
+					SeverityNumber int                        `json:"severityNumber"`
+					SeverityText   string                     `json:"severityText"`
+					Body           map[string]json.RawMessage `json:"body"`
+					Attributes     []keyValue                 `json:"attributes"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return err
+	}
+
+	// every AnyValue is a single key object, the int64 values are strings
+	value := func(v map[string]json.RawMessage) interface{} {
+		for kind, raw := range v {
+			var decoded interface{}
+			_ = json.Unmarshal(raw, &decoded)
+			if kind == "intValue" {
+				var n int64
+				fmt.Sscan(decoded.(string), &n)
+				return n
+			}
+			return decoded
+		}
+		return nil
+	}
+
+	attributes := func(keyValues []keyValue) map[string]interface{} {
+		values := make(map[string]interface{}, len(keyValues))
+		for _, kv := range keyValues {
+			values[kv.Key] = value(kv.Value)
+		}
+		return values
+	}
+
+	for _, resourceLogs := range request.ResourceLogs {
+		c.resource = attributes(resourceLogs.Resource.Attributes)
+		for _, scopeLogs := range resourceLogs.ScopeLogs {
+			for _, record := range scopeLogs.LogRecords {
+				var timeUnixNano uint64
+				fmt.Sscan(record.TimeUnixNano, &timeUnixNano)
+
+				body, _ := value(record.Body).(string)
+				c.records = append(c.records, otlpDecodedRecord{
+					timeUnixNano:   timeUnixNano,
+					severityNumber: record.SeverityNumber,
+					severityText:   record.SeverityText,
+					body:           body,
+					attributes:     attributes(record.Attributes),
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// protoFields splits a protobuf message in its fields, the values are uint64 for varint and
+// fixed64 fields and []byte for length delimited ones
+func protoFields(message []byte) (map[int][]interface{}, error) {
+	fields := make(map[int][]interface{})
+
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid field key")
+		}
+		message = message[n:]
+
+		number := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint of field %d", number)
+			}
+			fields[number] = append(fields[number], value)
+			message = message[n:]
+		case 1:
+			if len(message) < 8 {
+				return nil, fmt.Errorf("truncated fixed64 of field %d", number)
+			}
+			fields[number] = append(fields[number], binary.LittleEndian.Uint64(message))
+			message = message[8:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return nil, fmt.Errorf("truncated field %d", number)
+			}
+			fields[number] = append(fields[number], message[n:n+int(length)])
+			message = message[n+int(length):]
+		default:
+			return nil, fmt.Errorf("unexpected wire type %d", key&7)
+		}
+	}
+
+	return fields, nil
+}
+
+func (c *otlpStandIn) decodeProto(body []byte) error {
+	value := func(message []byte) interface{} {
+		fields, _ := protoFields(message)
+		switch {
+		case fields[otlpValueString] != nil:
+			return string(fields[otlpValueString][0].([]byte))
+		case fields[otlpValueBool] != nil:
+			return fields[otlpValueBool][0].(uint64) == 1
+		case fields[otlpValueInt] != nil:
+			return int64(fields[otlpValueInt][0].(uint64))
+		case fields[otlpValueDouble] != nil:
+			return math.Float64frombits(fields[otlpValueDouble][0].(uint64))
+		}
+		return nil
+	}
+
+	attributes := func(keyValues []interface{}) map[string]interface{} {
+		values := make(map[string]interface{}, len(keyValues))
+		for _, kv := range keyValues {
+			fields, _ := protoFields(kv.([]byte))
+			values[string(fields[otlpKeyValueKey][0].([]byte))] = value(fields[otlpKeyValueValue][0].([]byte))
+		}
+		return values
+	}
+
+	request, err := protoFields(body)
+	if err != nil {
+		return err
+	}
+
+	for _, rl := range request[otlpRequestResourceLogs] {
+		resourceLogs, err := protoFields(rl.([]byte))
+		if err != nil {
+			return err
+		}
+
+		resource, err := protoFields(resourceLogs[otlpResourceLogsResource][0].([]byte))
+		if err != nil {
+			return err
+		}
+		c.resource = attributes(resource[otlpResourceAttributes])
+
+		for _, sl := range resourceLogs[otlpResourceLogsScopeLogs] {
+			scopeLogs, err := protoFields(sl.([]byte))
+			if err != nil {
+				return err
+			}
+
+			for _, lr := range scopeLogs[otlpScopeLogsLogRecords] {
+				record, err := protoFields(lr.([]byte))
+				if err != nil {
+					return err
+				}
+
+				body, _ := value(record[otlpRecordBody][0].([]byte)).(string)
+				c.records = append(c.records, otlpDecodedRecord{
+					timeUnixNano:   record[otlpRecordTimeUnixNano][0].(uint64),
+					severityNumber: int(record[otlpRecordSeverityNumber][0].(uint64)),
+					severityText:   string(record[otlpRecordSeverityText][0].([]byte)),
+					body:           body,
+					attributes:     attributes(record[otlpRecordAttributes]),
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestOTLPSinkExportsToCollector(t *testing.T) {
+	for _, encoding := range []string{OTLPEncodingJSON, OTLPEncodingProtobuf} {
+		t.Run(encoding, func(t *testing.T) {
+			collector := &otlpStandIn{failures: 1}
+			server := httptest.NewServer(collector)
+			defer server.Close()
+
+			sink, err := NewOTLPSink(OTLPConfig{
+				Endpoint: server.URL,
+				Encoding: encoding,
+				Retry:    RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+				Service:  ServiceInfo{Service: "billing", Env: "prod", Version: "1.2.0", Hostname: "web-1"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l := newLocalLogger(t)
+			l.AddSink(sink, logrus.TraceLevel, nil)
+
+			l.SendWarnLog("disk low", map[string]interface{}{"free": 12, "ratio": 0.5, "user.name": "bob", "cached": true})
+			l.SendErrLog("write failed", nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := l.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			collector.mu.Lock()
+			defer collector.mu.Unlock()
+
+			if len(collector.records) != 2 {
+				t.Fatalf("collector received %d records, want 2", len(collector.records))
+			}
+
+			warn := collector.records[0]
+			if warn.body != "disk low" || warn.severityNumber != 13 || warn.severityText != "WARN" {
+				t.Errorf("warning record is %+v", warn)
+			}
+
+			if warn.timeUnixNano == 0 {
+				t.Error("the record has no timestamp")
+			}
+
+			if warn.attributes["free"] != int64(12) || warn.attributes["ratio"] != 0.5 ||
+				warn.attributes["user.name"] != "bob" || warn.attributes["cached"] != true {
+				t.Errorf("warning attributes are %v", warn.attributes)
+			}
+
+			if _, ok := warn.attributes["ddsource"]; ok {
+				t.Error("the DataDog source is sent as attribute")
+			}
+
+			if collector.records[1].severityNumber != 17 {
+				t.Errorf("error severity number is %d, want 17", collector.records[1].severityNumber)
+			}
+
+			if collector.resource["service.name"] != "billing" || collector.resource["deployment.environment"] != "prod" ||
+				collector.resource["service.version"] != "1.2.0" || collector.resource["host.name"] != "web-1" {
+				t.Errorf("resource attributes are %v", collector.resource)
+			}
+
+			if retried := l.Stats().Retried; retried != 1 {
+				t.Errorf("retried %d times, want 1", retried)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package logpet
+
+import "encoding/binary"
+
+// Protocol buffers wire types
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+)
+
+// protoBuffer is a minimal protocol buffers encoder, enough for the OTLP and Loki messages
+type protoBuffer struct {
+	b []byte
+}
+
+func (p *protoBuffer) tag(field, wireType int) {
+	p.appendUvarint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (p *protoBuffer) appendUvarint(value uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], value)
+	p.b = append(p.b, buf[:n]...)
+}
+
+// uvarint writes an unsigned varint field, zero values are omitted like proto3 does
+func (p *protoBuffer) uvarint(field int, value uint64) {
+	if value != 0 {
+		p.writeUvarint(field, value)
+	}
+}
+
+// writeUvarint writes an unsigned varint field even if zero, as needed by oneof fields
+func (p *protoBuffer) writeUvarint(field int, value uint64) {
+	p.tag(field, protoWireVarint)
+	p.appendUvarint(value)
+}
+
+// varint writes a signed int64 field as a two's complement varint
+func (p *protoBuffer) varint(field int, value int64) {
+	p.uvarint(field, uint64(value))
+}
+
+// fixed64 writes a fixed64 field, zero is omitted
+func (p *protoBuffer) fixed64(field int, value uint64) {
+	if value != 0 {
+		p.writeFixed64(field, value)
+	}
+}
+
+// writeFixed64 writes a fixed64 field even if zero, as needed by oneof fields
+func (p *protoBuffer) writeFixed64(field int, value uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], value)
+
+	p.tag(field, protoWireFixed64)
+	p.b = append(p.b, buf[:]...)
+}
+
+// bytes writes a length delimited field, used for strings, bytes and embedded messages
+func (p *protoBuffer) bytes(field int, value []byte) {
+	p.tag(field, protoWireBytes)
+	p.appendUvarint(uint64(len(value)))
+	p.b = append(p.b, value...)
+}
+
+// string writes a string field, the empty string is omitted
+func (p *protoBuffer) string(field int, value string) {
+	if value == "" {
+		return
+	}
+
+	p.bytes(field, []byte(value))
+}
+
+// Bytes returns the encoded message
+func (p *protoBuffer) Bytes() []byte {
+	return p.b
+}
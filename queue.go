@@ -0,0 +1,303 @@
+package logpet
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy selects what happens when a log is sent while the queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until there is room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the log being sent.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued log to make room.
+	OverflowDropOldest
+	// OverflowDropByLevel discards the oldest queued log with the least severe level,
+	// or the log being sent if it's not more severe than any queued log.
+	// Errors and more severe logs are never discarded, they wait for room instead.
+	OverflowDropByLevel
+)
+
+// QueueConfig controls the in-memory queue between the SendXxxLog methods and the shippers.
+type QueueConfig struct {
+	Capacity int
+	Overflow OverflowPolicy
+}
+
+// DefaultQueueConfig returns the queue configuration used by NewLogger
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Capacity: defaultQueueCapacity,
+		Overflow: OverflowDropByLevel,
+	}
+}
+
+// QueueStats reports the state of the queue and how many logs it discarded.
+type QueueStats struct {
+	Capacity       int
+	Depth          int
+	DroppedNewest  int64
+	DroppedOldest  int64
+	DroppedByLevel int64
+	DroppedClosed  int64
+}
+
+// logQueue is a bounded FIFO ring of logs, safe for concurrent use.
+type logQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    []Log
+	head     int
+	count    int
+	busy     int
+	policy   OverflowPolicy
+	closed   bool
+	stats    QueueStats
+}
+
+func newLogQueue(config QueueConfig) *logQueue {
+	if config.Capacity <= 0 {
+		config.Capacity = defaultQueueCapacity
+	}
+
+	q := &logQueue{
+		items:  make([]Log, config.Capacity),
+		policy: config.Overflow,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+
+	return q
+}
+
+// configure changes capacity and overflow policy keeping the queued logs
+func (q *logQueue) configure(config QueueConfig) error {
+	if config.Capacity <= 0 {
+		return fmt.Errorf("invalid queue capacity %d", config.Capacity)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.count > config.Capacity {
+		return fmt.Errorf("unable to shrink the queue to %d, %d logs are queued", config.Capacity, q.count)
+	}
+
+	items := make([]Log, config.Capacity)
+	for i := 0; i < q.count; i++ {
+		items[i] = q.items[(q.head+i)%len(q.items)]
+	}
+
+	q.items = items
+	q.head = 0
+	q.policy = config.Overflow
+	q.notFull.Broadcast()
+
+	return nil
+}
+
+// push appends the log applying the overflow policy if the queue is full,
+// when block is true the caller waits for room whatever the policy is.
+// It returns false if the log has been discarded.
+func (q *logQueue) push(logElem Log, block bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		q.stats.DroppedClosed++
+		return false
+	}
+
+	if q.count == len(q.items) {
+		policy := q.policy
+		if block {
+			policy = OverflowBlock
+		}
+
+		switch policy {
+		case OverflowBlock:
+			if !q.waitNotFull() {
+				return false
+			}
+		case OverflowDropOldest:
+			q.removeAt(0)
+			q.stats.DroppedOldest++
+		case OverflowDropByLevel:
+			victim := q.leastSevere()
+			if logElem.Level < q.at(victim).Level {
+				q.removeAt(victim)
+				q.stats.DroppedByLevel++
+				break
+			}
+
+			if logElem.Level > logrus.ErrorLevel {
+				q.stats.DroppedByLevel++
+				return false
+			}
+
+			if !q.waitNotFull() {
+				return false
+			}
+		default:
+			q.stats.DroppedNewest++
+			return false
+		}
+	}
+
+	q.items[(q.head+q.count)%len(q.items)] = logElem
+	q.count++
+	q.notEmpty.Signal()
+
+	return true
+}
+
+// waitNotFull waits for room in the queue, it returns false counting the log
+// as discarded if the queue is closed meanwhile. Must be called with mu held.
+func (q *logQueue) waitNotFull() bool {
+	for q.count == len(q.items) && !q.closed {
+		q.notFull.Wait()
+	}
+
+	if q.closed {
+		q.stats.DroppedClosed++
+		return false
+	}
+
+	return true
+}
+
+// pop waits for the oldest log and removes it from the queue, marking the queue as busy
+// until done is called. It returns false once the queue is closed and empty.
+func (q *logQueue) pop() (Log, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.count == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+
+	if q.count == 0 {
+		return Log{}, false
+	}
+
+	logElem := q.at(0)
+	q.items[q.head] = Log{}
+	q.head = (q.head + 1) % len(q.items)
+	q.count--
+	q.busy++
+	q.notFull.Signal()
+
+	return logElem, true
+}
+
+// done marks a log returned by pop as handled
+func (q *logQueue) done() {
+	q.mu.Lock()
+	q.busy--
+	q.mu.Unlock()
+}
+
+// pending returns the number of queued logs plus the ones being handled
+func (q *logQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.count + q.busy
+}
+
+// close stops accepting logs, the queued ones can still be popped
+func (q *logQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+}
+
+// discard removes every queued log and returns how many were removed, the ones being handled are kept
+func (q *logQueue) discard() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	discarded := q.count
+	for i := range q.items {
+		q.items[i] = Log{}
+	}
+	q.head = 0
+	q.count = 0
+	q.notFull.Broadcast()
+
+	return discarded
+}
+
+// snapshot returns the current queue stats
+func (q *logQueue) snapshot() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	stats.Capacity = len(q.items)
+	stats.Depth = q.count
+
+	return stats
+}
+
+// at returns the i-th queued log. Must be called with mu held.
+func (q *logQueue) at(i int) Log {
+	return q.items[(q.head+i)%len(q.items)]
+}
+
+// leastSevere returns the position of the oldest queued log with the least severe level.
+// Must be called with mu held.
+func (q *logQueue) leastSevere() int {
+	victim := 0
+	for i := 1; i < q.count; i++ {
+		if q.at(i).Level > q.at(victim).Level {
+			victim = i
+		}
+	}
+
+	return victim
+}
+
+// removeAt removes the i-th queued log keeping the order of the others. Must be called with mu held.
+func (q *logQueue) removeAt(i int) {
+	if i == 0 {
+		q.items[q.head] = Log{}
+		q.head = (q.head + 1) % len(q.items)
+		q.count--
+		return
+	}
+
+	for ; i < q.count-1; i++ {
+		q.items[(q.head+i)%len(q.items)] = q.at(i + 1)
+	}
+
+	q.items[(q.head+q.count-1)%len(q.items)] = Log{}
+	q.count--
+}
+
+// SetQueueConfig changes capacity and overflow policy of the log queue, the queued logs are kept
+func (l *StandardLogger) SetQueueConfig(config QueueConfig) error {
+	if l.queue == nil {
+		l.queue = newLogQueue(config)
+		return nil
+	}
+
+	return l.queue.configure(config)
+}
+
+// QueueStats returns the state of the log queue and the number of logs discarded by it
+func (l *StandardLogger) QueueStats() QueueStats {
+	if l.queue == nil {
+		return QueueStats{}
+	}
+
+	return l.queue.snapshot()
+}
@@ -0,0 +1,198 @@
+package logpet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// popMessages pops n logs from the queue, returning their messages
+func popMessages(q *logQueue, n int) []string {
+	messages := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		logElem, ok := q.pop()
+		if !ok {
+			break
+		}
+		q.done()
+		messages = append(messages, logElem.Message)
+	}
+
+	return messages
+}
+
+func equalMessages(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestQueueOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy OverflowPolicy
+		// pushed is pushed after the queue is filled with first and second, both info logs
+		pushed   Log
+		accepted bool
+		popped   []string
+		stats    QueueStats
+	}{
+		{
+			name:     "drop newest",
+			policy:   OverflowDropNewest,
+			pushed:   Log{Message: "third", Level: logrus.ErrorLevel},
+			accepted: false,
+			popped:   []string{"first", "second"},
+			stats:    QueueStats{Capacity: 2, Depth: 2, DroppedNewest: 1},
+		},
+		{
+			name:     "drop oldest",
+			policy:   OverflowDropOldest,
+			pushed:   Log{Message: "third", Level: logrus.DebugLevel},
+			accepted: true,
+			popped:   []string{"second", "third"},
+			stats:    QueueStats{Capacity: 2, Depth: 2, DroppedOldest: 1},
+		},
+		{
+			name:     "drop by level keeps the more severe log",
+			policy:   OverflowDropByLevel,
+			pushed:   Log{Message: "third", Level: logrus.WarnLevel},
+			accepted: true,
+			popped:   []string{"second", "third"},
+			stats:    QueueStats{Capacity: 2, Depth: 2, DroppedByLevel: 1},
+		},
+		{
+			name:     "drop by level drops the less severe log",
+			policy:   OverflowDropByLevel,
+			pushed:   Log{Message: "third", Level: logrus.DebugLevel},
+			accepted: false,
+			popped:   []string{"first", "second"},
+			stats:    QueueStats{Capacity: 2, Depth: 2, DroppedByLevel: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newLogQueue(QueueConfig{Capacity: 2, Overflow: test.policy})
+			q.push(Log{Message: "first", Level: logrus.InfoLevel}, false)
+			q.push(Log{Message: "second", Level: logrus.InfoLevel}, false)
+
+			if accepted := q.push(test.pushed, false); accepted != test.accepted {
+				t.Errorf("push returned %v, want %v", accepted, test.accepted)
+			}
+
+			if stats := q.snapshot(); stats != test.stats {
+				t.Errorf("stats are %+v", stats)
+			}
+
+			if popped := popMessages(q, 2); !equalMessages(popped, test.popped) {
+				t.Errorf("popped %v, want %v", popped, test.popped)
+			}
+		})
+	}
+}
+
+func TestQueueDropByLevelRemovesTheOldestLeastSevere(t *testing.T) {
+	q := newLogQueue(QueueConfig{Capacity: 3, Overflow: OverflowDropByLevel})
+	q.push(Log{Message: "info", Level: logrus.InfoLevel}, false)
+	q.push(Log{Message: "first debug", Level: logrus.DebugLevel}, false)
+	q.push(Log{Message: "second debug", Level: logrus.DebugLevel}, false)
+
+	q.push(Log{Message: "warning", Level: logrus.WarnLevel}, false)
+
+	if popped := popMessages(q, 3); !equalMessages(popped, []string{"info", "second debug", "warning"}) {
+		t.Errorf("popped %v, want the first debug log dropped", popped)
+	}
+}
+
+// pushAsync pushes the log in a goroutine, the returned channel receives the result of push
+func pushAsync(q *logQueue, logElem Log, block bool) chan bool {
+	result := make(chan bool, 1)
+	go func() {
+		result <- q.push(logElem, block)
+	}()
+
+	return result
+}
+
+func TestQueueWaitsForRoom(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy OverflowPolicy
+		pushed Log
+		block  bool
+	}{
+		{name: "block policy", policy: OverflowBlock, pushed: Log{Message: "third", Level: logrus.InfoLevel}},
+		{name: "blocking push", policy: OverflowDropNewest, pushed: Log{Message: "third", Level: logrus.InfoLevel}, block: true},
+		{name: "error never dropped by level", policy: OverflowDropByLevel, pushed: Log{Message: "third", Level: logrus.ErrorLevel}},
+		{name: "fatal never dropped by level", policy: OverflowDropByLevel, pushed: Log{Message: "third", Level: logrus.FatalLevel}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := newLogQueue(QueueConfig{Capacity: 2, Overflow: test.policy})
+			q.push(Log{Message: "first", Level: logrus.FatalLevel}, false)
+			q.push(Log{Message: "second", Level: logrus.FatalLevel}, false)
+
+			result := pushAsync(q, test.pushed, test.block)
+
+			select {
+			case <-result:
+				t.Fatal("push returned while the queue was full")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			if popped := popMessages(q, 1); !equalMessages(popped, []string{"first"}) {
+				t.Fatalf("popped %v, want [first]", popped)
+			}
+
+			if !<-result {
+				t.Fatal("the log was discarded")
+			}
+
+			if popped := popMessages(q, 2); !equalMessages(popped, []string{"second", "third"}) {
+				t.Errorf("popped %v, want [second third]", popped)
+			}
+
+			if stats := q.snapshot(); stats != (QueueStats{Capacity: 2}) {
+				t.Errorf("stats are %+v, want nothing dropped", stats)
+			}
+		})
+	}
+}
+
+func TestQueueDropsAfterClose(t *testing.T) {
+	q := newLogQueue(QueueConfig{Capacity: 1, Overflow: OverflowBlock})
+	q.push(Log{Message: "queued"}, false)
+
+	waiting := pushAsync(q, Log{Message: "waiting"}, false)
+	time.Sleep(10 * time.Millisecond)
+
+	q.close()
+
+	if <-waiting {
+		t.Error("the log waiting for room was queued after close")
+	}
+
+	if q.push(Log{Message: "late"}, true) {
+		t.Error("a log was queued after close")
+	}
+
+	if stats := q.snapshot(); stats.DroppedClosed != 2 || stats.Depth != 1 {
+		t.Errorf("stats are %+v, want 2 logs dropped as closed and 1 queued", stats)
+	}
+
+	// the queued logs can still be popped
+	if popped := popMessages(q, 2); !equalMessages(popped, []string{"queued"}) {
+		t.Errorf("popped %v, want [queued]", popped)
+	}
+}
@@ -0,0 +1,219 @@
+package logpet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how a failed request is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the backoff after each attempt.
+	Multiplier float64
+	// Jitter is the fraction of the backoff randomly subtracted from each wait, between 0 and 1.
+	Jitter float64
+	// AttemptTimeout is the maximum duration of a single attempt.
+	AttemptTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used by SetupDataDogLogger
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    defaultRetryMaxAttempts,
+		InitialBackoff: defaultRetryInitialBackoff,
+		MaxBackoff:     defaultRetryMaxBackoff,
+		Multiplier:     defaultRetryMultiplier,
+		Jitter:         defaultRetryJitter,
+		AttemptTimeout: defaultRetryAttemptTimeout,
+	}
+}
+
+// withDefaults returns a copy of the policy with invalid values replaced by the defaults
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+
+	if p.AttemptTimeout <= 0 {
+		p.AttemptTimeout = defaultRetryAttemptTimeout
+	}
+
+	return p
+}
+
+// do calls attempt until it succeeds, it returns a permanent error or the attempts are over.
+// Every attempt receives a context bounded by AttemptTimeout.
+func (p RetryPolicy) do(ctx context.Context, attempt func(ctx context.Context) error) error {
+	backoff := p.InitialBackoff
+
+	var err error
+	for i := 1; ; i++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+		err = attempt(attemptCtx)
+		cancel()
+
+		if err == nil || i >= p.MaxAttempts || !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(p.wait(err, backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff = time.Duration(float64(backoff) * p.Multiplier)
+		if backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// wait returns how long to wait before the next attempt, the Retry-After requested
+// by the intake if any, capped to two minutes, or the jittered backoff
+func (p RetryPolicy) wait(err error, backoff time.Duration) time.Duration {
+	if statusErr, ok := err.(*StatusError); ok && statusErr.RetryAfter > 0 {
+		if statusErr.RetryAfter > maxRetryAfter {
+			return maxRetryAfter
+		}
+		return statusErr.RetryAfter
+	}
+
+	return p.jittered(backoff)
+}
+
+// jittered returns the backoff reduced by a random fraction up to Jitter
+func (p RetryPolicy) jittered(backoff time.Duration) time.Duration {
+	if p.Jitter == 0 {
+		return backoff
+	}
+
+	return backoff - time.Duration(rand.Float64()*p.Jitter*float64(backoff))
+}
+
+// StatusError is returned when an intake answers with a non 2xx status code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is the wait requested by the intake with the Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status: %s", e.Status)
+}
+
+// Retryable reports whether the request can succeed if sent again
+func (e *StatusError) Retryable() bool {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout, e.StatusCode == http.StatusTooManyRequests:
+		return true
+	case e.StatusCode >= 500:
+		return true
+	default:
+		// 400, 403, 413 and the other client errors will fail again
+		return false
+	}
+}
+
+// permanentError wraps an error that won't be solved by sending the request again
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Retryable() bool {
+	return false
+}
+
+// isRetryable reports whether err is a transient failure, network errors are always retried
+func isRetryable(err error) bool {
+	if retryable, ok := err.(interface{ Retryable() bool }); ok {
+		return retryable.Retryable()
+	}
+
+	return true
+}
+
+// checkResponse drains and closes the response body, returning a *StatusError for non 2xx responses
+func checkResponse(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	// draining the body allows the connection to be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrainedResponseBytes))
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	statusErr := &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		statusErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	return statusErr
+}
+
+// parseRetryAfter parses the Retry-After header value, either delay seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+// SetRetryPolicy assign the provided retry policy to the client, invalid values fallback to the defaults
+func (l *StandardLogger) SetRetryPolicy(policy RetryPolicy) {
+	l.retryPolicy = policy.withDefaults()
+}
@@ -0,0 +1,142 @@
+package logpet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "empty", value: ""},
+		{name: "delay seconds", value: "30", min: 30 * time.Second, max: 30 * time.Second},
+		{name: "zero seconds", value: "0"},
+		{name: "negative seconds", value: "-5"},
+		{name: "HTTP date", value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{name: "past HTTP date", value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+		{name: "invalid", value: "soon"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if wait := parseRetryAfter(test.value); wait < test.min || wait > test.max {
+				t.Errorf("parseRetryAfter(%q) = %v, want between %v and %v", test.value, wait, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestRetryWaitCapsRetryAfter(t *testing.T) {
+	policy := RetryPolicy{}
+
+	tests := []struct {
+		err  error
+		want time.Duration
+	}{
+		{err: &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Second}, want: 10 * time.Second},
+		{err: &StatusError{StatusCode: http.StatusServiceUnavailable, RetryAfter: time.Hour}, want: maxRetryAfter},
+		{err: &StatusError{StatusCode: http.StatusInternalServerError}, want: time.Second},
+		{err: errors.New("connection reset"), want: time.Second},
+	}
+
+	for _, test := range tests {
+		if wait := policy.wait(test.err, time.Second); wait != test.want {
+			t.Errorf("wait after %v is %v, want %v", test.err, wait, test.want)
+		}
+	}
+}
+
+func TestRetryableErrors(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{err: &StatusError{StatusCode: http.StatusInternalServerError}, retryable: true},
+		{err: &StatusError{StatusCode: http.StatusServiceUnavailable}, retryable: true},
+		{err: &StatusError{StatusCode: http.StatusTooManyRequests}, retryable: true},
+		{err: &StatusError{StatusCode: http.StatusRequestTimeout}, retryable: true},
+		{err: errors.New("connection refused"), retryable: true},
+		{err: ErrCircuitOpen, retryable: true},
+		{err: &StatusError{StatusCode: http.StatusBadRequest}},
+		{err: &StatusError{StatusCode: http.StatusForbidden}},
+		{err: &StatusError{StatusCode: http.StatusRequestEntityTooLarge}},
+		{err: permanentError{errors.New("invalid payload")}},
+	}
+
+	for _, test := range tests {
+		if retryable := isRetryable(test.err); retryable != test.retryable {
+			t.Errorf("isRetryable(%v) = %v, want %v", test.err, retryable, test.retryable)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Multiplier: 1, AttemptTimeout: time.Second}
+	transient := &StatusError{StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		err      error
+		// permanent is whether do must return a permanent error
+		permanent bool
+	}{
+		{name: "success", errs: []error{nil}, attempts: 1},
+		{name: "success after retries", errs: []error{transient, transient, nil}, attempts: 3},
+		{name: "attempts over", errs: []error{transient, transient, transient, nil}, attempts: 3, err: transient},
+		{name: "permanent error", errs: []error{&StatusError{StatusCode: http.StatusBadRequest}, nil}, attempts: 1, permanent: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			err := policy.do(context.Background(), func(ctx context.Context) error {
+				err := test.errs[attempts]
+				attempts++
+				return err
+			})
+
+			if attempts != test.attempts {
+				t.Errorf("made %d attempts, want %d", attempts, test.attempts)
+			}
+
+			if test.err != nil && err != test.err {
+				t.Errorf("do returned %v, want %v", err, test.err)
+			}
+
+			if test.permanent && (err == nil || isRetryable(err)) {
+				t.Errorf("do returned %v, want the permanent error", err)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoStopsOnCancel(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour, MaxBackoff: time.Hour, Multiplier: 1, AttemptTimeout: time.Second}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	start := time.Now()
+	err := policy.do(ctx, func(ctx context.Context) error {
+		attempts++
+		return errors.New("connection refused")
+	})
+
+	if attempts != 1 || err == nil {
+		t.Errorf("made %d attempts returning %v, want 1 attempt and its error", attempts, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("do returned after %v, the backoff wasn't interrupted", elapsed)
+	}
+}
@@ -0,0 +1,168 @@
+package logpet
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SampleRateField is the attribute carrying the sample rate of a sampled log,
+// the real number of occurrences is the number of logs divided by the rate.
+const SampleRateField = "sample_rate"
+
+// RateLimit is a token bucket: Burst logs can be sent at once, then PerSecond logs per second.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// SamplingConfig controls which logs are kept before they enter the queue.
+// Rates are the fraction of logs kept, between 0 and 1. Fatal logs are never sampled
+// nor rate limited since they terminate the process.
+type SamplingConfig struct {
+	// DefaultRate applies to info, warning, debug and trace logs without a more specific rate.
+	// Error logs are only sampled by an explicit LevelRates or TemplateRates entry.
+	// Zero means no sampling.
+	DefaultRate float64
+	// LevelRates overrides DefaultRate for a level.
+	LevelRates map[logrus.Level]float64
+	// TemplateRates overrides the level rate for a message template, that is the format
+	// string of the SendXxxfLog methods or the message of the SendXxxLog ones.
+	TemplateRates map[string]float64
+	// LevelLimits rate limits the logs of a level.
+	LevelLimits map[logrus.Level]RateLimit
+	// TemplateLimits rate limits the logs of a message template.
+	TemplateLimits map[string]RateLimit
+}
+
+// sampler applies a SamplingConfig to the logs sent to the logger
+type sampler struct {
+	config  SamplingConfig
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newSampler(config SamplingConfig) *sampler {
+	return &sampler{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// admit reports whether the log is kept, storing the applied sample rate in the log
+// and counting the discarded ones in metrics.
+func (s *sampler) admit(logElem *Log, metrics *pipelineMetrics) bool {
+	if logElem.Level == logrus.FatalLevel {
+		return true
+	}
+
+	template := logElem.template
+	if template == "" {
+		template = logElem.Message
+	}
+
+	rate := s.rate(logElem.Level, template)
+	if rate < 1 && rand.Float64() >= rate {
+		atomic.AddInt64(&metrics.droppedSampled, 1)
+		return false
+	}
+
+	if limit, ok := s.config.LevelLimits[logElem.Level]; ok && !s.take("level:"+logElem.Level.String(), limit) {
+		atomic.AddInt64(&metrics.droppedRateLimited, 1)
+		return false
+	}
+
+	if limit, ok := s.config.TemplateLimits[template]; ok && !s.take("template:"+template, limit) {
+		atomic.AddInt64(&metrics.droppedRateLimited, 1)
+		return false
+	}
+
+	logElem.sampleRate = rate
+
+	return true
+}
+
+// rate returns the fraction of logs kept for the level and template, 1 means every log
+func (s *sampler) rate(level logrus.Level, template string) float64 {
+	rate, ok := s.config.TemplateRates[template]
+
+	if !ok {
+		rate, ok = s.config.LevelRates[level]
+	}
+
+	if !ok && level > logrus.ErrorLevel && s.config.DefaultRate > 0 {
+		rate, ok = s.config.DefaultRate, true
+	}
+
+	if !ok || rate >= 1 {
+		return 1
+	}
+
+	if rate < 0 {
+		return 0
+	}
+
+	return rate
+}
+
+// take consumes a token from the bucket with the provided key, creating it if needed
+func (s *sampler) take(key string, limit RateLimit) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(limit)
+		s.buckets[key] = bucket
+	}
+
+	return bucket.take(time.Now())
+}
+
+// tokenBucket is a token bucket refilled continuously, not safe for concurrent use
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+// take refills the bucket for the time elapsed since the last call and consumes a token if available
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.PerSecond
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// SetSampling applies the provided sampling rates and rate limits to the logs sent from now on
+func (l *StandardLogger) SetSampling(config SamplingConfig) {
+	l.sampler = newSampler(config)
+}
+
+// DisableSampling keeps every log sent from now on
+func (l *StandardLogger) DisableSampling() {
+	l.sampler = nil
+}
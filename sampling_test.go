@@ -0,0 +1,158 @@
+package logpet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSamplerRates(t *testing.T) {
+	s := newSampler(SamplingConfig{
+		LevelRates: map[logrus.Level]float64{
+			logrus.DebugLevel: 0,
+			logrus.InfoLevel:  1,
+			logrus.FatalLevel: 0,
+		},
+		TemplateRates: map[string]float64{
+			"noisy %s": 0,
+			"kept":     1,
+		},
+		// the default rate doesn't apply to errors
+		DefaultRate: 0.000001,
+	})
+
+	tests := []struct {
+		name string
+		log  Log
+		kept bool
+	}{
+		{name: "level rate 0", log: Log{Message: "debug", Level: logrus.DebugLevel}},
+		{name: "level rate 1", log: Log{Message: "info", Level: logrus.InfoLevel}, kept: true},
+		{name: "template rate 0 overrides the level rate", log: Log{Message: "noisy x", template: "noisy %s", Level: logrus.InfoLevel}},
+		{name: "template rate 1 overrides the level rate", log: Log{Message: "kept", Level: logrus.DebugLevel}, kept: true},
+		{name: "errors exempt from the default rate", log: Log{Message: "error", Level: logrus.ErrorLevel}, kept: true},
+		{name: "fatal never sampled", log: Log{Message: "fatal", Level: logrus.FatalLevel}, kept: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var metrics pipelineMetrics
+
+			for i := 0; i < 100; i++ {
+				logElem := test.log
+				if kept := s.admit(&logElem, &metrics); kept != test.kept {
+					t.Fatalf("admit returned %v, want %v", kept, test.kept)
+				}
+			}
+
+			dropped := metrics.droppedSampled
+			if test.kept && dropped != 0 || !test.kept && dropped != 100 {
+				t.Errorf("counted %d logs as sampled out", dropped)
+			}
+		})
+	}
+}
+
+func TestSamplerExplicitErrorRate(t *testing.T) {
+	s := newSampler(SamplingConfig{LevelRates: map[logrus.Level]float64{logrus.ErrorLevel: 0}})
+
+	var metrics pipelineMetrics
+	if s.admit(&Log{Message: "error", Level: logrus.ErrorLevel}, &metrics) {
+		t.Error("the error was kept with an explicit error rate of 0")
+	}
+}
+
+func TestSamplerRateLimits(t *testing.T) {
+	s := newSampler(SamplingConfig{
+		LevelLimits:    map[logrus.Level]RateLimit{logrus.WarnLevel: {Burst: 2}},
+		TemplateLimits: map[string]RateLimit{"retrying %s": {Burst: 3}},
+	})
+
+	var metrics pipelineMetrics
+
+	kept := 0
+	for i := 0; i < 5; i++ {
+		if s.admit(&Log{Message: "retrying", template: "retrying %s", Level: logrus.InfoLevel}, &metrics) {
+			kept++
+		}
+	}
+
+	if kept != 3 {
+		t.Errorf("kept %d logs of the limited template, want 3", kept)
+	}
+
+	kept = 0
+	for i := 0; i < 5; i++ {
+		if s.admit(&Log{Message: "warning", Level: logrus.WarnLevel}, &metrics) {
+			kept++
+		}
+	}
+
+	if kept != 2 {
+		t.Errorf("kept %d logs of the limited level, want 2", kept)
+	}
+
+	if metrics.droppedRateLimited != 5 || metrics.droppedSampled != 0 {
+		t.Errorf("counted %d rate limited and %d sampled out logs, want 5 and 0",
+			metrics.droppedRateLimited, metrics.droppedSampled)
+	}
+
+	// the other templates and levels aren't limited
+	if !s.admit(&Log{Message: "other", Level: logrus.InfoLevel}, &metrics) {
+		t.Error("a log without limits was dropped")
+	}
+}
+
+func TestSampledLogsCarryTheSampleRate(t *testing.T) {
+	l := newLocalLogger(t)
+	output := &syncBuffer{}
+	l.localRoute.sink = NewWriterSink(output)
+	l.SetSampling(SamplingConfig{TemplateRates: map[string]float64{"sampled": 0.5}})
+
+	for i := 0; i < 200; i++ {
+		l.SendInfoLog("sampled", nil)
+	}
+	l.SendInfoLog("not sampled", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := l.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	output.mu.Lock()
+	data := output.buf.Bytes()
+	output.mu.Unlock()
+
+	sampled := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		switch entry["msg"] {
+		case "sampled":
+			sampled++
+			if entry[SampleRateField] != 0.5 {
+				t.Errorf("the sampled log has %s %v, want 0.5", SampleRateField, entry[SampleRateField])
+			}
+		case "not sampled":
+			if _, ok := entry[SampleRateField]; ok {
+				t.Errorf("the log kept without sampling has %s", SampleRateField)
+			}
+		}
+	}
+
+	dropped := l.Stats().Dropped[DropReasonSampled]
+	if sampled == 0 || dropped == 0 || int64(sampled)+dropped != 200 {
+		t.Errorf("kept %d and sampled out %d logs, want both and 200 in total", sampled, dropped)
+	}
+}
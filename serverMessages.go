@@ -1,15 +1,19 @@
 package logpet
 
+import "github.com/sirupsen/logrus"
+
 // ====================================
 //
 // Info Logs Messages
 //
 //====================================
 
-// HTTPServerStarted prints the string "Started, listening on port: %s" with an Info error.
+// HTTPServerStarted sends the string "Started, listening on port: %s" with an Info error.
 // It accepts a string as port where the server listens.
 func (l *StandardLogger) HTTPServerStarted(port string) {
-	l.AddCustomFields().Infof(httpServerStatusStarted, port)
+	l.sendEvent(logrus.InfoLevel, EventHTTPServerStarted, map[string]interface{}{
+		HTTPPortField: port,
+	}, httpServerStatusStarted, port)
 }
 
 // ====================================
@@ -18,22 +22,29 @@ func (l *StandardLogger) HTTPServerStarted(port string) {
 //
 //====================================
 
-// HTTPServerUnauthorizedResponse prints the string "%s tried to connect on resource: %s, but it’s unauthorized." with a Warning error.
+// HTTPServerUnauthorizedResponse sends the string "%s tried to connect on resource: %s, but it’s unauthorized." with a Warning error.
 // It accepts two strings representing the host that made the request and the resource that it wants.
 func (l *StandardLogger) HTTPServerUnauthorizedResponse(request, resource string) {
-	l.AddCustomFields().Warningf(serverStatusUnauthorized, request, resource)
+	l.sendEvent(logrus.WarnLevel, EventHTTPServerUnauthorized, map[string]interface{}{
+		HTTPClientField:   request,
+		HTTPResourceField: resource,
+	}, serverStatusUnauthorized, request, resource)
 }
 
-// HTTPServerInvalidBodyResponse prints the string "%s sent a request but I don’t know how to read the body." with a Warning error.
+// HTTPServerInvalidBodyResponse sends the string "%s sent a request but I don’t know how to read the body." with a Warning error.
 // It accepts a string representing the host that made the request.
 func (l *StandardLogger) HTTPServerInvalidBodyResponse(request string) {
-	l.AddCustomFields().Warningf(serverBodyInvalid, request)
+	l.sendEvent(logrus.WarnLevel, EventHTTPServerInvalidBody, map[string]interface{}{
+		HTTPClientField: request,
+	}, serverBodyInvalid, request)
 }
 
-// HTTPServerSendResponseError prints the string "Can't send the response, error: %s" with a Warning error.
+// HTTPServerSendResponseError sends the string "Can't send the response, error: %s" with a Warning error.
 // It accepts a string representing the error
 func (l *StandardLogger) HTTPServerSendResponseError(error string) {
-	l.AddCustomFields().Warningf(serverSendResponse, error)
+	l.sendEvent(logrus.WarnLevel, EventHTTPServerSendResponseError, map[string]interface{}{
+		ErrorMessageField: error,
+	}, serverSendResponse, error)
 }
 
 // ====================================
@@ -42,8 +53,10 @@ func (l *StandardLogger) HTTPServerSendResponseError(error string) {
 //
 //====================================
 
-// InvalidDatabaseConnection prints the string "Invalid connection to the database: %s" with a Fatal error.
-// It accepts a string that could be the hostname of the database.
+// HTTPServerStartingError sends the string "Error starting HTTP server on port: %s" with a Fatal error.
+// It accepts a string that should be the port of the server.
 func (l *StandardLogger) HTTPServerStartingError(port string) {
-	l.AddCustomFields().Fatalf(httpServerStartingError, port)
+	l.sendEvent(logrus.FatalLevel, EventHTTPServerStartingError, map[string]interface{}{
+		HTTPPortField: port,
+	}, httpServerStartingError, port)
 }
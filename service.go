@@ -0,0 +1,177 @@
+package logpet
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ServiceInfo holds the unified service tags attached to every log.
+type ServiceInfo struct {
+	Service  string
+	Env      string
+	Version  string
+	Hostname string
+	// Tags are additional key:value tags sent as ddtags.
+	Tags []string
+}
+
+// ddtags returns the env, version and custom tags in the comma separated DataDog format
+func (s ServiceInfo) ddtags() string {
+	tags := make([]string, 0, len(s.Tags)+2)
+
+	if s.Env != "" {
+		tags = append(tags, "env:"+s.Env)
+	}
+
+	if s.Version != "" {
+		tags = append(tags, "version:"+s.Version)
+	}
+
+	tags = append(tags, s.Tags...)
+
+	return strings.Join(tags, ",")
+}
+
+// serviceMetadataFields are the attributes added to every log from the service info,
+// omitted by the outputs not needing them on each entry
+var serviceMetadataFields = map[string]bool{
+	"ddsource": true,
+	"ddtags":   true,
+	"hostname": true,
+	"service":  true,
+}
+
+// fields returns the DataDog reserved attributes for the service info, empty values are omitted
+func (s ServiceInfo) fields() map[string]interface{} {
+	fields := make(map[string]interface{}, 3)
+
+	if s.Service != "" {
+		fields["service"] = s.Service
+	}
+
+	if s.Hostname != "" {
+		fields["hostname"] = s.Hostname
+	}
+
+	if tags := s.ddtags(); tags != "" {
+		fields["ddtags"] = tags
+	}
+
+	return fields
+}
+
+// withDefaults returns the service info with the empty values taken from defaults
+func (s ServiceInfo) withDefaults(defaults ServiceInfo) ServiceInfo {
+	if s.Service == "" {
+		s.Service = defaults.Service
+	}
+
+	if s.Env == "" {
+		s.Env = defaults.Env
+	}
+
+	if s.Version == "" {
+		s.Version = defaults.Version
+	}
+
+	if s.Hostname == "" {
+		s.Hostname = defaults.Hostname
+	}
+
+	if len(s.Tags) == 0 {
+		s.Tags = defaults.Tags
+	}
+
+	return s
+}
+
+// serviceInfoFromEnv reads the service info from the DataDog environment variables,
+// the hostname fallbacks to the one reported by the kernel.
+func serviceInfoFromEnv() ServiceInfo {
+	info := ServiceInfo{
+		Service:  os.Getenv("DD_SERVICE"),
+		Env:      os.Getenv("DD_ENV"),
+		Version:  os.Getenv("DD_VERSION"),
+		Hostname: os.Getenv("DD_HOSTNAME"),
+		Tags:     parseTags(os.Getenv("DD_TAGS")),
+	}
+
+	if info.Hostname == "" {
+		info.Hostname, _ = os.Hostname()
+	}
+
+	return info
+}
+
+// parseTags splits a list of tags separated by commas or spaces
+func parseTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// ServiceInfo returns the unified service tags attached to every log
+func (l *StandardLogger) ServiceInfo() ServiceInfo {
+	return l.serviceInfo
+}
+
+// SetServiceInfo replaces the unified service tags attached to every log
+func (l *StandardLogger) SetServiceInfo(info ServiceInfo) {
+	l.serviceInfo = info
+}
+
+// SetService sets the service name attached to every log, it overrides DD_SERVICE
+func (l *StandardLogger) SetService(service string) {
+	l.serviceInfo.Service = service
+}
+
+// SetEnv sets the environment attached to every log as env tag, it overrides DD_ENV
+func (l *StandardLogger) SetEnv(env string) {
+	l.serviceInfo.Env = env
+}
+
+// SetVersion sets the version attached to every log as version tag, it overrides DD_VERSION
+func (l *StandardLogger) SetVersion(version string) {
+	l.serviceInfo.Version = version
+}
+
+// SetHostname sets the hostname attached to every log
+func (l *StandardLogger) SetHostname(hostname string) {
+	l.serviceInfo.Hostname = hostname
+}
+
+// AddTags adds key:value tags sent as ddtags with every log
+func (l *StandardLogger) AddTags(tags ...string) {
+	l.serviceInfo.Tags = append(l.serviceInfo.Tags, tags...)
+}
+
+// DataDogSiteEndpoint returns the logs intake URL of the provided DataDog site.
+// It accepts both the site domain (e.g. datadoghq.eu) and its short name (e.g. eu, us3).
+func DataDogSiteEndpoint(site string) (string, error) {
+	site = strings.ToLower(strings.TrimSpace(site))
+
+	if domain, ok := dataDogSites[site]; ok {
+		site = domain
+	}
+
+	for _, domain := range dataDogSites {
+		if site == domain {
+			return fmt.Sprintf(dataDogSiteEndpointFormat, site), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown DataDog site %q", site)
+}
+
+// SetDataDogSite sets the DataDog endpoint to the logs intake of the provided site
+func (l *StandardLogger) SetDataDogSite(site string) error {
+	endpoint, err := DataDogSiteEndpoint(site)
+	if err != nil {
+		return err
+	}
+
+	l.SetDataDogEndpoint(endpoint)
+
+	return nil
+}
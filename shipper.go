@@ -0,0 +1,140 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// httpShipper posts payloads with the retry policy and compression shared by the HTTP sinks,
+// reporting the outcome to the pipeline stats
+type httpShipper struct {
+	client      *http.Client
+	retry       RetryPolicy
+	compression Compression
+	metrics     *pipelineMetrics
+}
+
+func newHTTPShipper(client *http.Client, retry RetryPolicy, compression Compression) *httpShipper {
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+
+	return &httpShipper{
+		client:      client,
+		retry:       retry.withDefaults(),
+		compression: compression,
+		metrics:     &pipelineMetrics{},
+	}
+}
+
+// attach reports the stats to the logger instead of discarding them
+func (s *httpShipper) attach(l *StandardLogger) {
+	s.metrics = &l.metrics
+}
+
+// dropBacklog counts the entries of a batch dropped because too many batches were waiting to be shipped
+func (s *httpShipper) dropBacklog(batch [][]byte) {
+	atomic.AddInt64(&s.metrics.droppedBacklog, int64(len(batch)))
+}
+
+// post sends the payload holding the provided number of entries, retrying transient failures
+func (s *httpShipper) post(ctx context.Context, url string, header http.Header, payload []byte, entries int) error {
+	body, err := s.compression.compress(payload)
+	if err != nil {
+		return err
+	}
+
+	err = s.retryDo(ctx, func(ctx context.Context) error {
+		resp, err := s.do(ctx, url, header, body)
+		if err != nil {
+			return err
+		}
+
+		return checkResponse(resp)
+	})
+
+	if err != nil {
+		atomic.AddInt64(&s.metrics.failed, int64(entries))
+		atomic.AddInt64(&s.metrics.droppedSendFailed, int64(entries))
+		return err
+	}
+
+	s.metrics.recordSent(entries, len(body))
+
+	return nil
+}
+
+// retryDo calls attempt with the retry policy, counting the retries
+func (s *httpShipper) retryDo(ctx context.Context, attempt func(ctx context.Context) error) error {
+	attempts := 0
+
+	return s.retry.do(ctx, func(ctx context.Context) error {
+		if attempts++; attempts > 1 {
+			atomic.AddInt64(&s.metrics.retried, 1)
+		}
+
+		return attempt(ctx)
+	})
+}
+
+// do posts the already compressed body with the provided headers, the caller must close the response body
+func (s *httpShipper) do(ctx context.Context, url string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if s.compression.Encoding != CompressionNone {
+		req.Header.Set("Content-Encoding", s.compression.Encoding)
+	}
+
+	return s.client.Do(req)
+}
+
+// batchedHTTPSink is embedded by the HTTP sinks: it batches the encoded entries and ships
+// them with the send function of the sink, which only has to encode entries and payloads
+type batchedHTTPSink struct {
+	shipper *httpShipper
+	batcher *batcher
+	cancel  context.CancelFunc
+}
+
+func newBatchedHTTPSink(client *http.Client, retry RetryPolicy, compression Compression) batchedHTTPSink {
+	return batchedHTTPSink{shipper: newHTTPShipper(client, retry, compression)}
+}
+
+// start creates the batcher shipping with send, the batches dropped because too many were
+// waiting are passed to drop or just counted if nil
+func (s *batchedHTTPSink) start(config BatchConfig, send func(ctx context.Context, batch [][]byte) error, drop func(batch [][]byte)) {
+	if drop == nil {
+		drop = s.shipper.dropBacklog
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.cancel = cancel
+	s.batcher = newBatcher(config.withDefaults(), ctx, send, drop)
+}
+
+func (s *batchedHTTPSink) attach(l *StandardLogger) {
+	s.shipper.attach(l)
+}
+
+// Flush ships the current batch, returning early if ctx expires
+func (s *batchedHTTPSink) Flush(ctx context.Context) error {
+	return s.batcher.flush(ctx)
+}
+
+// Close ships the current batch and stops the pending retries
+func (s *batchedHTTPSink) Close(ctx context.Context) error {
+	err := s.Flush(ctx)
+	s.cancel()
+
+	return err
+}
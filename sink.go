@@ -0,0 +1,236 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sink is a destination of log entries.
+// Write receives the entry and its bytes encoded with the formatter of the sink,
+// both are only valid during the call so a sink must copy what it keeps.
+type Sink interface {
+	Write(entry *logrus.Entry, formatted []byte) error
+	Flush(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// loggerAttacher is implemented by the built-in sinks reporting to the pipeline stats of the logger
+type loggerAttacher interface {
+	attach(l *StandardLogger)
+}
+
+// offlineReplayer is implemented by the built-in sinks keeping their own offline logs,
+// which are sent again by SendOfflineLogs
+type offlineReplayer interface {
+	sendOfflineLogs(ctx context.Context) error
+}
+
+// sinkRoute is a sink with the minimum level and the formatter of the entries it receives
+type sinkRoute struct {
+	sink      Sink
+	minLevel  logrus.Level
+	formatter logrus.Formatter
+}
+
+// accepts reports whether the route receives entries of the provided level
+func (r *sinkRoute) accepts(level logrus.Level) bool {
+	return level <= r.minLevel
+}
+
+// AddSink adds a destination receiving every entry at least as severe as minLevel, encoded
+// with formatter. If formatter is nil the formatter of the logger is used. Besides the logrus ones,
+// ConsoleFormatter, LogfmtFormatter, ECSFormatter and CloudWatchFormatter can be used.
+func (l *StandardLogger) AddSink(sink Sink, minLevel logrus.Level, formatter logrus.Formatter) {
+	if attachable, ok := sink.(loggerAttacher); ok {
+		attachable.attach(l)
+	}
+
+	l.sinksMu.Lock()
+	defer l.sinksMu.Unlock()
+
+	l.sinks = append(l.sinks, &sinkRoute{
+		sink:      sink,
+		minLevel:  minLevel,
+		formatter: formatter,
+	})
+}
+
+// routes returns the default route followed by the ones added with AddSink
+func (l *StandardLogger) routes() []*sinkRoute {
+	l.sinksMu.RLock()
+	defer l.sinksMu.RUnlock()
+
+	routes := make([]*sinkRoute, 0, len(l.sinks)+1)
+
+	if route := l.dataDogRouteLocked(); route != nil {
+		routes = append(routes, route)
+	}
+
+	return append(routes, l.sinks...)
+}
+
+// dataDogRoutes returns only the DataDog route, used by the logs replayed from its spool
+func (l *StandardLogger) dataDogRoutes() []*sinkRoute {
+	l.sinksMu.RLock()
+	defer l.sinksMu.RUnlock()
+
+	if route := l.dataDogRouteLocked(); route != nil {
+		return []*sinkRoute{route}
+	}
+
+	return nil
+}
+
+// dataDogRouteLocked returns the DataDog route, nil if not set up. Must be called with sinksMu held.
+func (l *StandardLogger) dataDogRouteLocked() *sinkRoute {
+	// local mode replaces DataDog with the stdout
+	if l.localMode {
+		return l.localRoute
+	}
+
+	return l.ddRoute
+}
+
+// writeToSinks encodes the entry for every route accepting its level and writes it
+func (l *StandardLogger) writeToSinks(routes []*sinkRoute, entry *logrus.Entry) error {
+	var firstErr error
+
+	for _, route := range routes {
+		if !route.accepts(entry.Level) {
+			continue
+		}
+
+		formatter := route.formatter
+		if formatter == nil {
+			formatter = l.Formatter
+		}
+
+		formatted, err := formatter.Format(entry)
+		if err == nil {
+			err = route.sink.Write(entry, formatted)
+		}
+
+		if err != nil {
+			log.Printf("unable to write log to %T, %v", route.sink, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// flushSinks flushes every sink, returning the first error
+func (l *StandardLogger) flushSinks(ctx context.Context) error {
+	var firstErr error
+
+	for _, route := range l.routes() {
+		if err := route.sink.Flush(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// closeSinks closes every sink, returning the first error
+func (l *StandardLogger) closeSinks(ctx context.Context) error {
+	var firstErr error
+
+	for _, route := range l.routes() {
+		if err := route.sink.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// WriterSink writes every entry on its own line to an io.Writer.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink returns a sink writing entries to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewStdoutSink returns a sink writing entries to the standard output
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+// Write writes the formatted entry followed by a new line
+func (s *WriterSink) Write(entry *logrus.Entry, formatted []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line := bytes.TrimRight(formatted, "\n")
+
+	if _, err := s.w.Write(line); err != nil {
+		return err
+	}
+
+	_, err := s.w.Write([]byte{'\n'})
+	return err
+}
+
+// Flush does nothing since entries are written synchronously
+func (s *WriterSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing, the writer is owned by the caller
+func (s *WriterSink) Close(ctx context.Context) error {
+	return nil
+}
+
+// FileSink appends every entry on its own line to a file.
+type FileSink struct {
+	WriterSink
+	file *os.File
+}
+
+// NewFileSink opens, or creates, the file at path in append mode and returns a sink writing to it
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open log file %s, %v", path, err)
+	}
+
+	return &FileSink{
+		WriterSink: WriterSink{w: file},
+		file:       file,
+	}, nil
+}
+
+// Flush commits the written entries to disk
+func (s *FileSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Sync()
+}
+
+// Close syncs and closes the file
+func (s *FileSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.file.Sync(); err != nil {
+		_ = s.file.Close()
+		return err
+	}
+
+	return s.file.Close()
+}
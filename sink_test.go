@@ -0,0 +1,111 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) lines() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return bytes.Count(b.buf.Bytes(), []byte{'\n'})
+}
+
+func TestFailingDestinationDoesNotBlockOtherSinks(t *testing.T) {
+	release := make(chan struct{})
+	intake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer intake.Close()
+	defer close(release)
+
+	l := NewLogger()
+	l.SetBatchConfig(BatchConfig{MaxEntries: 1})
+	l.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second})
+	if err := l.SetupDataDogLogger(intake.URL, "api-key", "", false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &syncBuffer{}
+	l.AddSink(NewWriterSink(file), logrus.TraceLevel, nil)
+
+	for i := 0; i < 10; i++ {
+		l.SendErrLog("dependency down", nil)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for file.lines() < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if lines := file.lines(); lines != 10 {
+		t.Fatalf("the file sink received %d lines while DataDog was failing, want 10", lines)
+	}
+}
+
+func TestBatcherDropsOldestPendingBatch(t *testing.T) {
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var shipped, dropped []string
+
+	b := newBatcher(BatchConfig{MaxEntries: 1, MaxBytes: 1 << 20, MaxLinger: time.Hour, MaxPending: 2}, context.Background(),
+		func(ctx context.Context, batch [][]byte) error {
+			<-release
+			mu.Lock()
+			shipped = append(shipped, string(batch[0]))
+			mu.Unlock()
+			return nil
+		},
+		func(batch [][]byte) {
+			dropped = append(dropped, string(batch[0]))
+		})
+
+	// the first batch is being shipped, the next two wait and the fourth one drops the second
+	for _, item := range []string{"1", "2", "3", "4"} {
+		b.add([]byte(item))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := b.flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(dropped) != 1 || dropped[0] != "2" {
+		t.Errorf("dropped %v, want [2]", dropped)
+	}
+
+	if len(shipped) != 3 || shipped[0] != "1" || shipped[1] != "3" || shipped[2] != "4" {
+		t.Errorf("shipped %v, want [1 3 4]", shipped)
+	}
+}
@@ -0,0 +1,315 @@
+package logpet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SplunkConfig configures the Splunk HTTP Event Collector sink.
+type SplunkConfig struct {
+	// Endpoint is the URL of the event endpoint, defaults to https://localhost:8088/services/collector/event.
+	Endpoint string
+	// Token is the HEC token sent with the Splunk authorization scheme.
+	Token string
+	// Host defaults to DD_HOSTNAME or the one reported by the kernel.
+	Host string
+	// Source defaults to logpet.
+	Source string
+	// Sourcetype defaults to _json.
+	Sourcetype string
+	// Index is the target index, the default index of the token is used if empty.
+	Index string
+	// Channel is sent as X-Splunk-Request-Channel, a random one is generated if Ack is enabled and Channel is empty.
+	Channel string
+	// Ack waits for every batch to be acknowledged by the indexers. If the token has indexer acknowledgment
+	// disabled the accepted batches are counted as sent without waiting.
+	Ack bool
+	// AckTimeout is how long to wait for a batch to be acknowledged, defaults to one minute.
+	AckTimeout time.Duration
+	// AckPollInterval is how often the acknowledgment is checked, defaults to one second.
+	AckPollInterval time.Duration
+	// HTTPClient defaults to a client with a 30 seconds timeout.
+	HTTPClient *http.Client
+	Batch      BatchConfig
+	Retry      RetryPolicy
+	// Compression accepts CompressionNone and CompressionGzip.
+	Compression Compression
+}
+
+// SplunkSink ships batches of entries to the Splunk HTTP Event Collector. Every entry is wrapped in
+// the HEC envelope, the event is the entry encoded by the formatter of the sink: JSON objects are
+// embedded as they are, any other output is sent as a string.
+type SplunkSink struct {
+	batchedHTTPSink
+	config SplunkConfig
+	ackURL string
+	header http.Header
+	// ackWarning logs once that the token has indexer acknowledgment disabled
+	ackWarning sync.Once
+}
+
+// hecResponse is the response of the event and ack endpoints
+type hecResponse struct {
+	Text  string          `json:"text"`
+	Code  int             `json:"code"`
+	AckID *int64          `json:"ackId"`
+	Acks  map[string]bool `json:"acks"`
+}
+
+// NewSplunkSink returns a sink shipping entries to the provided HTTP Event Collector
+func NewSplunkSink(config SplunkConfig) (*SplunkSink, error) {
+	if config.Token == "" {
+		return nil, fmt.Errorf("no Splunk HEC token provided")
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = defaultSplunkEndpoint
+	}
+
+	if config.Host == "" {
+		config.Host = serviceInfoFromEnv().Hostname
+	}
+
+	if config.Source == "" {
+		config.Source = defaultSplunkSource
+	}
+
+	if config.Sourcetype == "" {
+		config.Sourcetype = defaultSplunkSourcetype
+	}
+
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = defaultSplunkAckTimeout
+	}
+
+	if config.AckPollInterval <= 0 {
+		config.AckPollInterval = defaultSplunkAckPollInterval
+	}
+
+	if config.Compression.Encoding != CompressionNone && config.Compression.Encoding != CompressionGzip {
+		return nil, fmt.Errorf("content encoding %q not supported by Splunk HEC", config.Compression.Encoding)
+	}
+
+	if err := config.Compression.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Ack && config.Channel == "" {
+		channel, err := newChannelID()
+		if err != nil {
+			return nil, err
+		}
+		config.Channel = channel
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Splunk HEC endpoint %s, %v", config.Endpoint, err)
+	}
+
+	// the ack endpoint is a sibling of the event one, e.g. /services/collector/ack
+	if i := strings.Index(endpoint.Path, "/services/collector"); i >= 0 {
+		endpoint.Path = endpoint.Path[:i]
+	}
+	endpoint.Path += "/services/collector/ack"
+	endpoint.RawQuery = ""
+
+	header := make(http.Header)
+	header.Set("Authorization", "Splunk "+config.Token)
+	header.Set("Content-Type", "application/json")
+	if config.Channel != "" {
+		header.Set("X-Splunk-Request-Channel", config.Channel)
+	}
+
+	sink := &SplunkSink{
+		batchedHTTPSink: newBatchedHTTPSink(config.HTTPClient, config.Retry, config.Compression),
+		config:          config,
+		ackURL:          endpoint.String(),
+		header:          header,
+	}
+	sink.start(config.Batch, sink.send, nil)
+
+	return sink, nil
+}
+
+// Write wraps the formatted entry in the HEC envelope and adds it to the current batch
+func (s *SplunkSink) Write(entry *logrus.Entry, formatted []byte) error {
+	event := json.RawMessage(bytes.TrimSpace(formatted))
+	if len(event) == 0 || event[0] != '{' || !json.Valid(event) {
+		encoded, err := json.Marshal(string(event))
+		if err != nil {
+			return err
+		}
+		event = encoded
+	}
+
+	envelope := struct {
+		Time       json.Number     `json:"time"`
+		Host       string          `json:"host,omitempty"`
+		Source     string          `json:"source,omitempty"`
+		Sourcetype string          `json:"sourcetype,omitempty"`
+		Index      string          `json:"index,omitempty"`
+		Event      json.RawMessage `json:"event"`
+	}{
+		// epoch seconds with milliseconds
+		Time:       json.Number(fmt.Sprintf("%d.%03d", entry.Time.Unix(), entry.Time.Nanosecond()/int(time.Millisecond))),
+		Host:       s.config.Host,
+		Source:     s.config.Source,
+		Sourcetype: s.config.Sourcetype,
+		Index:      s.config.Index,
+		Event:      event,
+	}
+
+	item, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	s.batcher.add(item)
+
+	return nil
+}
+
+// send posts the batch of events, waiting for the acknowledgment when enabled
+func (s *SplunkSink) send(ctx context.Context, batch [][]byte) error {
+	metrics := s.shipper.metrics
+
+	// HEC accepts multiple events in the same request one after the other
+	body, err := s.shipper.compression.compress(bytes.Join(batch, []byte{'\n'}))
+	if err != nil {
+		return err
+	}
+
+	var ackID *int64
+	err = s.shipper.retryDo(ctx, func(ctx context.Context) error {
+		resp, err := s.shipper.do(ctx, s.config.Endpoint, s.header, body)
+		if err != nil {
+			return err
+		}
+
+		if !s.config.Ack {
+			return checkResponse(resp)
+		}
+
+		response, err := decodeHECResponse(resp)
+		if err != nil {
+			return err
+		}
+
+		ackID = response.AckID
+		return nil
+	})
+
+	// the events were accepted, without ackId they just can't be acknowledged
+	if err == nil && s.config.Ack && ackID == nil {
+		s.ackWarning.Do(func() {
+			log.Printf("no ackId in the Splunk HEC response, indexer acknowledgment is disabled for the token")
+		})
+	}
+
+	if err == nil && ackID != nil {
+		err = s.waitAck(ctx, *ackID)
+	}
+
+	if err != nil {
+		atomic.AddInt64(&metrics.failed, int64(len(batch)))
+		atomic.AddInt64(&metrics.droppedSendFailed, int64(len(batch)))
+		return err
+	}
+
+	metrics.recordSent(len(batch), len(body))
+
+	return nil
+}
+
+// waitAck polls the ack endpoint until the request is acknowledged or the ack timeout expires
+func (s *SplunkSink) waitAck(ctx context.Context, ackID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.AckTimeout)
+	defer cancel()
+
+	query, err := json.Marshal(map[string][]int64{"acks": {ackID}})
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(s.config.AckPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("batch %d not acknowledged by Splunk, %v", ackID, ctx.Err())
+		case <-ticker.C:
+		}
+
+		// the ack query is tiny, it's never compressed
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.ackURL, bytes.NewReader(query))
+		if err != nil {
+			return err
+		}
+
+		for key, values := range s.header {
+			req.Header[key] = values
+		}
+
+		resp, err := s.shipper.client.Do(req)
+		if err != nil {
+			continue
+		}
+
+		response, err := decodeHECResponse(resp)
+		if err != nil {
+			if isRetryable(err) {
+				continue
+			}
+			return err
+		}
+
+		if response.Acks[strconv.FormatInt(ackID, 10)] {
+			return nil
+		}
+	}
+}
+
+// decodeHECResponse decodes and closes the response body, non 2xx responses are returned as *StatusError
+func decodeHECResponse(resp *http.Response) (*hecResponse, error) {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, checkResponse(resp)
+	}
+
+	defer resp.Body.Close()
+
+	var response hecResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("unable to decode the Splunk HEC response, %v", err)
+	}
+
+	return &response, nil
+}
+
+// newChannelID returns a random UUID used as HEC request channel
+func newChannelID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", fmt.Errorf("unable to generate the Splunk HEC channel, %v", err)
+	}
+
+	// version 4, variant RFC 4122
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]), nil
+}
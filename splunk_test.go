@@ -0,0 +1,104 @@
+package logpet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// hecStandIn is a local HTTP Event Collector, with indexer acknowledgment if ack is true
+type hecStandIn struct {
+	mu     sync.Mutex
+	ack    bool
+	events int
+	polls  int
+}
+
+func (c *hecStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/ack") {
+		// acknowledged at the second poll
+		c.polls++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"acks": map[string]bool{"7": c.polls > 1}})
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	for decoder.More() {
+		var event map[string]interface{}
+		if err := decoder.Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.events++
+	}
+
+	response := map[string]interface{}{"text": "Success", "code": 0}
+	if c.ack {
+		response["ackId"] = 7
+	}
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func TestSplunkSinkCountsAcceptedBatches(t *testing.T) {
+	for _, ack := range []bool{true, false} {
+		name := "token without acknowledgment"
+		if ack {
+			name = "token with acknowledgment"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			collector := &hecStandIn{ack: ack}
+			server := httptest.NewServer(collector)
+			defer server.Close()
+
+			sink, err := NewSplunkSink(SplunkConfig{
+				Endpoint:        server.URL + "/services/collector/event",
+				Token:           "token",
+				Ack:             true,
+				AckPollInterval: time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l := newLocalLogger(t)
+			l.AddSink(sink, logrus.TraceLevel, &logrus.JSONFormatter{})
+
+			l.SendInfoLog("first", nil)
+			l.SendInfoLog("second", nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := l.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			stats := l.Stats()
+			if stats.Failed != 0 {
+				t.Errorf("%d logs failed, want 0", stats.Failed)
+			}
+
+			collector.mu.Lock()
+			defer collector.mu.Unlock()
+
+			if collector.events != 2 {
+				t.Errorf("the collector received %d events, want 2", collector.events)
+			}
+
+			if ack && collector.polls != 2 {
+				t.Errorf("the acknowledgment was polled %d times, want 2", collector.polls)
+			}
+		})
+	}
+}
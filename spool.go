@@ -0,0 +1,439 @@
+package logpet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpoolDropPolicy selects what happens when a log is spooled while the spool is full.
+type SpoolDropPolicy int
+
+const (
+	// SpoolDropNewest discards the log being spooled.
+	SpoolDropNewest SpoolDropPolicy = iota
+	// SpoolDropOldest removes the oldest segments to make room.
+	SpoolDropOldest
+)
+
+// SpoolConfig controls the offline logs spool, where the logs that couldn't be shipped are
+// appended as NDJSON to segment files until SendOfflineLogs replays them.
+type SpoolConfig struct {
+	// MaxSegmentBytes is the size after which a new segment is started.
+	MaxSegmentBytes int64
+	// MaxSegmentAge is how long a segment is written before a new one is started.
+	MaxSegmentAge time.Duration
+	// MaxTotalBytes is the disk budget of every segment together.
+	MaxTotalBytes int64
+	// Policy applies when a log doesn't fit in the disk budget.
+	Policy SpoolDropPolicy
+}
+
+// DefaultSpoolConfig returns the spool configuration used when offline logs are enabled
+func DefaultSpoolConfig() SpoolConfig {
+	return SpoolConfig{
+		MaxSegmentBytes: defaultSpoolMaxSegmentBytes,
+		MaxSegmentAge:   defaultSpoolMaxSegmentAge,
+		MaxTotalBytes:   defaultSpoolMaxTotalBytes,
+		Policy:          SpoolDropOldest,
+	}
+}
+
+// withDefaults returns a copy of the config with invalid limits replaced by the defaults
+func (c SpoolConfig) withDefaults() SpoolConfig {
+	if c.MaxSegmentBytes <= 0 {
+		c.MaxSegmentBytes = defaultSpoolMaxSegmentBytes
+	}
+
+	if c.MaxSegmentAge <= 0 {
+		c.MaxSegmentAge = defaultSpoolMaxSegmentAge
+	}
+
+	if c.MaxTotalBytes <= 0 {
+		c.MaxTotalBytes = defaultSpoolMaxTotalBytes
+	}
+
+	return c
+}
+
+// SetSpoolConfig assign the provided spool configuration to the client, invalid limits fallback to the defaults
+func (l *StandardLogger) SetSpoolConfig(config SpoolConfig) {
+	l.spoolMu.Lock()
+	defer l.spoolMu.Unlock()
+
+	l.spoolConfig = config.withDefaults()
+	l.spoolConfigSet = true
+
+	if l.spool != nil {
+		l.spool.configure(l.spoolConfig)
+	}
+}
+
+// offlineSpool returns the spool of the offline logs path, opening it if needed
+func (l *StandardLogger) offlineSpool() (*spool, error) {
+	l.spoolMu.Lock()
+	defer l.spoolMu.Unlock()
+
+	if l.spool != nil && l.spool.dir == l.offlineLogsPath {
+		return l.spool, nil
+	}
+
+	s, err := openSpool(l.offlineLogsPath, l.spoolConfigLocked())
+	if err != nil {
+		return nil, err
+	}
+
+	l.spool = s
+
+	return s, nil
+}
+
+// spoolSettings returns the spool configuration of the logger
+func (l *StandardLogger) spoolSettings() SpoolConfig {
+	l.spoolMu.Lock()
+	defer l.spoolMu.Unlock()
+
+	return l.spoolConfigLocked()
+}
+
+// spoolConfigLocked returns the spool configuration of the logger. Must be called with spoolMu held.
+func (l *StandardLogger) spoolConfigLocked() SpoolConfig {
+	if !l.spoolConfigSet {
+		return DefaultSpoolConfig()
+	}
+
+	return l.spoolConfig
+}
+
+// spoolSegment is a segment file and its size
+type spoolSegment struct {
+	seq  uint64
+	size int64
+}
+
+// spool appends records to the last segment, safe for concurrent use.
+// Segments are opened on every append, so a segment is complete as soon as the append returns.
+type spool struct {
+	mu       sync.Mutex
+	dir      string
+	config   SpoolConfig
+	segments []spoolSegment
+	total    int64
+	// nextSeq is the sequence number of the next segment
+	nextSeq uint64
+	// current is whether the last segment is still written and when it was started
+	current   bool
+	startedAt time.Time
+}
+
+// openSpool creates the directory if needed and loads the existing segments,
+// the last segment written by a previous process is not appended to
+func openSpool(dir string, config SpoolConfig) (*spool, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no offline logs path provided")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{dir: dir, config: config, nextSeq: 1}
+
+	for _, file := range files {
+		seq, ok := parseSegmentName(file.Name())
+		if !ok || file.IsDir() {
+			continue
+		}
+
+		s.segments = append(s.segments, spoolSegment{seq: seq, size: file.Size()})
+		s.total += file.Size()
+
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	return s, nil
+}
+
+func (s *spool) configure(config SpoolConfig) {
+	s.mu.Lock()
+	s.config = config
+	s.mu.Unlock()
+}
+
+// append writes the records as lines of the current segment, starting a new one when the current
+// one is too large or too old. It returns how many records were written, how many didn't fit in the
+// disk budget and how many were removed with the oldest segments to make room.
+func (s *spool) append(records [][]byte) (written, dropped, evicted int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data []byte
+	for _, record := range records {
+		line, lineErr := spoolLine(record)
+		if lineErr != nil {
+			if err == nil {
+				err = lineErr
+			}
+			continue
+		}
+
+		if int64(len(line)) > s.config.MaxTotalBytes {
+			dropped++
+			continue
+		}
+
+		if s.total+int64(len(data)+len(line)) > s.config.MaxTotalBytes && s.config.Policy == SpoolDropOldest {
+			// the pending lines are written first since their segment may be removed
+			if flushErr := s.flush(&data, &written); flushErr != nil {
+				return written, dropped, evicted, flushErr
+			}
+
+			for len(s.segments) > 0 && s.total+int64(len(line)) > s.config.MaxTotalBytes {
+				removed, removeErr := s.removeOldest()
+				if removeErr != nil {
+					break
+				}
+				evicted += removed
+			}
+		}
+
+		if s.total+int64(len(data)+len(line)) > s.config.MaxTotalBytes {
+			dropped++
+			continue
+		}
+
+		if s.current && s.rotationDue(int64(len(data)), int64(len(line))) {
+			if flushErr := s.flush(&data, &written); flushErr != nil {
+				return written, dropped, evicted, flushErr
+			}
+			s.current = false
+		}
+
+		if !s.current {
+			s.startSegment()
+		}
+
+		data = append(data, line...)
+	}
+
+	if flushErr := s.flush(&data, &written); flushErr != nil {
+		return written, dropped, evicted, flushErr
+	}
+
+	return written, dropped, evicted, err
+}
+
+// appendCounting appends the records like append, counting them in the pipeline stats
+func (s *spool) appendCounting(records [][]byte, metrics *pipelineMetrics) {
+	written, dropped, evicted, err := s.append(records)
+
+	atomic.AddInt64(&metrics.spooled, int64(written))
+	atomic.AddInt64(&metrics.droppedSpoolFull, int64(dropped+evicted))
+
+	if err != nil {
+		atomic.AddInt64(&metrics.droppedSpoolFailed, int64(len(records)-written-dropped))
+		log.Printf("unable to save logs offline, %v", err)
+	}
+}
+
+// flush writes the pending lines to the current segment and counts them as written
+func (s *spool) flush(data *[]byte, written *int) error {
+	if len(*data) == 0 {
+		return nil
+	}
+
+	if err := s.write(*data); err != nil {
+		return err
+	}
+
+	*written += bytes.Count(*data, []byte{'\n'})
+	*data = nil
+
+	return nil
+}
+
+// rotationDue reports whether the current segment, holding pending more bytes, is too old
+// or too large for n more bytes. An empty segment is never rotated.
+func (s *spool) rotationDue(pending, n int64) bool {
+	size := s.segments[len(s.segments)-1].size + pending
+	if size == 0 {
+		return false
+	}
+
+	return size+n > s.config.MaxSegmentBytes || time.Since(s.startedAt) >= s.config.MaxSegmentAge
+}
+
+// startSegment starts a new empty segment, the file is created by the first write
+func (s *spool) startSegment() {
+	s.segments = append(s.segments, spoolSegment{seq: s.nextSeq})
+	s.nextSeq++
+	s.current = true
+	s.startedAt = time.Now()
+}
+
+// write appends the lines to the current segment
+func (s *spool) write(data []byte) error {
+	last := &s.segments[len(s.segments)-1]
+
+	file, err := os.OpenFile(s.path(last.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	n, err := file.Write(data)
+	last.size += int64(n)
+	s.total += int64(n)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// removeOldest removes the oldest segment and returns how many records it held
+func (s *spool) removeOldest() (int, error) {
+	oldest := s.segments[0]
+
+	content, err := ioutil.ReadFile(s.path(oldest.seq))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	if err := os.Remove(s.path(oldest.seq)); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	s.segments = s.segments[1:]
+	s.total -= oldest.size
+
+	if len(s.segments) == 0 {
+		s.current = false
+	}
+
+	return bytes.Count(content, []byte{'\n'}), nil
+}
+
+// rotate closes the current segment and returns the paths of every segment, oldest first
+func (s *spool) rotate() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current = false
+
+	paths := make([]string, 0, len(s.segments))
+	for _, segment := range s.segments {
+		paths = append(paths, s.path(segment.seq))
+	}
+
+	return paths
+}
+
+// remove removes the segment once its records have been replayed
+func (s *spool) remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i, segment := range s.segments {
+		if s.path(segment.seq) == path {
+			s.total -= segment.size
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf(spoolSegmentFormat, seq))
+}
+
+// readSegment calls fn with every non empty line of the segment and its line number,
+// a segment never written to is empty
+func readSegment(path string, fn func(line []byte, lineNumber int)) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			fn(line, lineNumber)
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseSegmentName returns the sequence number of a segment file name
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, spoolSegmentPrefix) || !strings.HasSuffix(name, spoolSegmentSuffix) {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, spoolSegmentPrefix), spoolSegmentSuffix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return seq, true
+}
+
+// spoolLine returns the record as a single NDJSON line, records spanning multiple lines are compacted
+func spoolLine(record []byte) ([]byte, error) {
+	record = bytes.TrimSpace(record)
+	if len(record) == 0 {
+		return nil, fmt.Errorf("empty offline log")
+	}
+
+	line := make([]byte, 0, len(record)+1)
+	if bytes.ContainsAny(record, "\r\n") {
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, record); err != nil {
+			return nil, fmt.Errorf("unable to write multi-line offline log, %v", err)
+		}
+		line = append(line, compacted.Bytes()...)
+	} else {
+		line = append(line, record...)
+	}
+
+	return append(line, '\n'), nil
+}
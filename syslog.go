@@ -0,0 +1,307 @@
+package logpet
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Transports of the syslog sink
+const (
+	SyslogUDP = "udp"
+	SyslogTCP = "tcp"
+	SyslogTLS = "tls"
+)
+
+// Message formats of the syslog sink
+const (
+	SyslogRFC5424 = "rfc5424"
+	SyslogRFC3164 = "rfc3164"
+)
+
+// SyslogSeverity is the severity of a syslog message as defined by RFC 5424.
+type SyslogSeverity int
+
+// Syslog severities
+const (
+	SyslogEmergency SyslogSeverity = iota
+	SyslogAlert
+	SyslogCritical
+	SyslogError
+	SyslogWarning
+	SyslogNotice
+	SyslogInformational
+	SyslogDebug
+)
+
+// SyslogFacility is the facility of a syslog message as defined by RFC 5424.
+type SyslogFacility int
+
+// Syslog facilities used by applications
+const (
+	SyslogFacilityUser   SyslogFacility = 1
+	SyslogFacilityDaemon SyslogFacility = 3
+	SyslogFacilityLocal0 SyslogFacility = 16
+	SyslogFacilityLocal1 SyslogFacility = 17
+	SyslogFacilityLocal2 SyslogFacility = 18
+	SyslogFacilityLocal3 SyslogFacility = 19
+	SyslogFacilityLocal4 SyslogFacility = 20
+	SyslogFacilityLocal5 SyslogFacility = 21
+	SyslogFacilityLocal6 SyslogFacility = 22
+	SyslogFacilityLocal7 SyslogFacility = 23
+)
+
+// DefaultSyslogSeverities returns the mapping of the logrus levels to the syslog severities
+func DefaultSyslogSeverities() map[logrus.Level]SyslogSeverity {
+	return map[logrus.Level]SyslogSeverity{
+		logrus.PanicLevel: SyslogEmergency,
+		logrus.FatalLevel: SyslogCritical,
+		logrus.ErrorLevel: SyslogError,
+		logrus.WarnLevel:  SyslogWarning,
+		logrus.InfoLevel:  SyslogInformational,
+		logrus.DebugLevel: SyslogDebug,
+		logrus.TraceLevel: SyslogDebug,
+	}
+}
+
+// SyslogConfig configures the RFC 5424 syslog sink.
+type SyslogConfig struct {
+	// Network is SyslogUDP, SyslogTCP or SyslogTLS.
+	Network string
+	// Format is SyslogRFC5424 or SyslogRFC3164 for the servers not supporting RFC 5424, defaults to SyslogRFC5424.
+	Format string
+	// Address is the host:port of the syslog server.
+	Address string
+	// TLSConfig is used by SyslogTLS, the system roots are used if nil.
+	TLSConfig *tls.Config
+	// Facility defaults to SyslogFacilityUser.
+	Facility SyslogFacility
+	// Severities overrides the severity of the provided levels, the other ones use DefaultSyslogSeverities.
+	Severities map[logrus.Level]SyslogSeverity
+	// AppName defaults to DD_SERVICE or the executable name.
+	AppName string
+	// Hostname defaults to DD_HOSTNAME or the one reported by the kernel.
+	Hostname string
+	// StructuredDataID is the SD-ID of the element holding the custom fields, defaults to logpet@32473.
+	StructuredDataID string
+	// Timeout of dials and writes, defaults to 30 seconds.
+	Timeout time.Duration
+	// Batch controls how many messages are written at once, they are written from a separate goroutine.
+	Batch BatchConfig
+}
+
+// SyslogSink sends every entry as an RFC 5424 message to a syslog server, connecting at the first write.
+// The custom fields are sent as structured data, TCP and TLS messages are framed with octet-counting.
+// With SyslogRFC3164 the structured data element starts the MSG part, since the format has none.
+type SyslogSink struct {
+	batchedNetSink
+	config     SyslogConfig
+	severities map[logrus.Level]SyslogSeverity
+	header     string
+}
+
+// NewSyslogSink returns a sink sending entries to the syslog server
+func NewSyslogSink(config SyslogConfig) (*SyslogSink, error) {
+	if config.Network != SyslogUDP && config.Network != SyslogTCP && config.Network != SyslogTLS {
+		return nil, fmt.Errorf("unsupported syslog network %q", config.Network)
+	}
+
+	if config.Format == "" {
+		config.Format = SyslogRFC5424
+	}
+
+	if config.Format != SyslogRFC5424 && config.Format != SyslogRFC3164 {
+		return nil, fmt.Errorf("unsupported syslog format %q", config.Format)
+	}
+
+	if config.Address == "" {
+		return nil, fmt.Errorf("no syslog address provided")
+	}
+
+	if config.Facility == 0 {
+		config.Facility = SyslogFacilityUser
+	}
+
+	if config.StructuredDataID == "" {
+		config.StructuredDataID = defaultSyslogStructuredDataID
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+
+	service := serviceInfoFromEnv()
+
+	if config.AppName == "" {
+		config.AppName = service.Service
+	}
+
+	if config.AppName == "" {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+
+	if config.Hostname == "" {
+		config.Hostname = service.Hostname
+	}
+
+	severities := DefaultSyslogSeverities()
+	for level, severity := range config.Severities {
+		severities[level] = severity
+	}
+
+	// HOSTNAME APP-NAME PROCID on RFC 5424, HOSTNAME TAG[PID]: on RFC 3164
+	header := strings.Join([]string{
+		syslogHeaderValue(config.Hostname, 255),
+		syslogHeaderValue(config.AppName, 48),
+		strconv.Itoa(os.Getpid()),
+	}, " ")
+
+	if config.Format == SyslogRFC3164 {
+		header = fmt.Sprintf("%s %s[%d]:",
+			syslogHeaderValue(config.Hostname, 255),
+			syslogHeaderValue(config.AppName, 32),
+			os.Getpid(),
+		)
+	}
+
+	sink := &SyslogSink{
+		batchedNetSink: newBatchedNetSink(newNetSender(config.Network, config.Address, config.TLSConfig, config.Timeout), nil),
+		config:         config,
+		severities:     severities,
+		header:         header,
+	}
+	sink.start(config.Batch)
+
+	return sink, nil
+}
+
+// Write adds the entry as a syslog message to the current batch, the formatted bytes are not used
+func (s *SyslogSink) Write(entry *logrus.Entry, formatted []byte) error {
+	message := s.message(entry)
+
+	// octet-counting framing on streams
+	if s.config.Network != SyslogUDP {
+		message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	}
+
+	s.batcher.add(message)
+
+	return nil
+}
+
+// message encodes the entry as PRI VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG,
+// or as PRI TIMESTAMP HOSTNAME TAG: STRUCTURED-DATA MSG with SyslogRFC3164
+func (s *SyslogSink) message(entry *logrus.Entry) []byte {
+	severity, ok := s.severities[entry.Level]
+	if !ok {
+		severity = SyslogDebug
+	}
+
+	priority := int(s.config.Facility)*8 + int(severity)
+
+	var b bytes.Buffer
+
+	if s.config.Format == SyslogRFC3164 {
+		fmt.Fprintf(&b, "<%d>%s %s ", priority, entry.Time.Format(syslogRFC3164TimestampFormat), s.header)
+		if s.writeStructuredData(&b, entry.Data) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(entry.Message)
+
+		return b.Bytes()
+	}
+
+	msgID := "-"
+	if code, ok := entry.Data[EventCodeField].(string); ok && code != "" {
+		msgID = syslogHeaderValue(code, 32)
+	}
+
+	fmt.Fprintf(&b, "<%d>1 %s %s %s ",
+		priority,
+		entry.Time.Format(syslogTimestampFormat),
+		s.header,
+		msgID,
+	)
+	if !s.writeStructuredData(&b, entry.Data) {
+		b.WriteByte('-')
+	}
+	b.WriteByte(' ')
+	b.WriteString(entry.Message)
+
+	return b.Bytes()
+}
+
+// writeStructuredData writes the custom fields as the parameters of a single SD element,
+// it returns false without writing anything if there are none
+func (s *SyslogSink) writeStructuredData(b *bytes.Buffer, data logrus.Fields) bool {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		if !serviceMetadataFields[key] && key != EventCodeField {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return false
+	}
+
+	sort.Strings(keys)
+
+	b.WriteByte('[')
+	b.WriteString(syslogName(s.config.StructuredDataID))
+	for _, key := range keys {
+		fmt.Fprintf(b, ` %s="`, syslogName(key))
+		syslogEscaper.WriteString(b, fieldString(data[key]))
+		b.WriteByte('"')
+	}
+	b.WriteByte(']')
+
+	return true
+}
+
+// syslogEscaper escapes the characters not allowed in a PARAM-VALUE
+var syslogEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogName returns an SD-NAME: at most 32 printable ASCII characters except '=', ' ', ']' and '"'
+func syslogName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if len(name) > 32 {
+		name = name[:32]
+	}
+
+	return name
+}
+
+// syslogHeaderValue returns a header field of at most maxLength printable ASCII characters, or the nil value
+func syslogHeaderValue(value string, maxLength int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+
+	if value == "" {
+		return "-"
+	}
+
+	if len(value) > maxLength {
+		value = value[:maxLength]
+	}
+
+	return value
+}
@@ -0,0 +1,194 @@
+package logpet
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readSyslogMessage reads a datagram from a UDP listener or an octet-counted frame from a TCP connection
+func readSyslogMessage(t *testing.T, packetConn net.PacketConn, reader *bufio.Reader) string {
+	if packetConn != nil {
+		_ = packetConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		buf := make([]byte, 64*1024)
+		n, _, err := packetConn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(buf[:n])
+	}
+
+	length, err := reader.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		t.Fatalf("the frame doesn't start with the octet count, %v", err)
+	}
+
+	message := make([]byte, n)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		t.Fatal(err)
+	}
+
+	return string(message)
+}
+
+func TestSyslogSinkFormats(t *testing.T) {
+	tests := []struct {
+		format  string
+		network string
+		pattern string
+	}{
+		{SyslogRFC5424, SyslogTCP, `^<12>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ host app \d+ EVT-1 \[logpet@32473 [^\]]*\] disk "full"$`},
+		{SyslogRFC5424, SyslogUDP, `^<12>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ host app \d+ EVT-1 \[logpet@32473 [^\]]*\] disk "full"$`},
+		{SyslogRFC3164, SyslogTCP, `^<12>[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d host app\[\d+\]: \[logpet@32473 [^\]]*\] disk "full"$`},
+		{SyslogRFC3164, SyslogUDP, `^<12>[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d host app\[\d+\]: \[logpet@32473 [^\]]*\] disk "full"$`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format+" over "+test.network, func(t *testing.T) {
+			var address string
+			var packetConn net.PacketConn
+			var listener net.Listener
+			var err error
+
+			if test.network == SyslogUDP {
+				packetConn, err = net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer packetConn.Close()
+				address = packetConn.LocalAddr().String()
+			} else {
+				listener, err = net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer listener.Close()
+				address = listener.Addr().String()
+			}
+
+			sink, err := NewSyslogSink(SyslogConfig{
+				Network:  test.network,
+				Format:   test.format,
+				Address:  address,
+				Hostname: "host",
+				AppName:  "app",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l := newLocalLogger(t)
+			l.AddSink(sink, logrus.TraceLevel, nil)
+
+			l.SendWarnLog(`disk "full"`, map[string]interface{}{EventCodeField: "EVT-1", "device": "sda"})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := l.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			var reader *bufio.Reader
+			if listener != nil {
+				conn, err := listener.Accept()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				reader = bufio.NewReader(conn)
+			}
+
+			message := readSyslogMessage(t, packetConn, reader)
+
+			if !regexp.MustCompile(test.pattern).MatchString(message) {
+				t.Errorf("the message %q doesn't match %s", message, test.pattern)
+			}
+
+			if !strings.Contains(message, ` device="sda"`) {
+				t.Errorf("the message %q doesn't hold the custom field", message)
+			}
+
+			if strings.Contains(message, EventCodeField+"=") {
+				t.Errorf("the event code is repeated in the structured data of %q", message)
+			}
+		})
+	}
+}
+
+func TestSyslogStructuredDataEscaping(t *testing.T) {
+	sink, err := NewSyslogSink(SyslogConfig{Network: SyslogUDP, Address: "127.0.0.1:514", Hostname: "host", AppName: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close(context.Background())
+
+	message := string(sink.message(&logrus.Entry{
+		Time:    time.Now(),
+		Level:   logrus.InfoLevel,
+		Message: "escaped",
+		Data: logrus.Fields{
+			"path":      `C:\logs`,
+			"quote":     `say "hi"`,
+			"bracket":   `[a]`,
+			"odd name=": "value",
+		},
+	}))
+
+	want := `[logpet@32473 bracket="[a\]" odd_name_="value" path="C:\\logs" quote="say \"hi\""] escaped`
+	if !strings.HasSuffix(message, want) {
+		t.Errorf("the message is %q, want it to end with %q", message, want)
+	}
+
+	message = string(sink.message(&logrus.Entry{Time: time.Now(), Level: logrus.InfoLevel, Message: "bare"}))
+	if !strings.HasSuffix(message, " - - bare") {
+		t.Errorf("the message without fields is %q, want the nil MSGID and STRUCTURED-DATA", message)
+	}
+}
+
+func TestSyslogSinkConnectsAtTheFirstWrite(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	// nothing listens on the address, creating the sink doesn't connect
+	sink, err := NewSyslogSink(SyslogConfig{Network: SyslogTCP, Address: address, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewSyslogSink returned %v without listener", err)
+	}
+
+	l := newLocalLogger(t)
+	l.AddSink(sink, logrus.TraceLevel, nil)
+
+	l.SendInfoLog("lost", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := l.Flush(ctx); err == nil {
+		t.Error("Flush didn't return the connection error")
+	}
+
+	if stats := l.Stats(); stats.Failed != 1 {
+		t.Errorf("%d logs failed, want 1", stats.Failed)
+	}
+}
@@ -1,23 +1,61 @@
 package logpet
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 // StandardLogger is a new type useful to add new methods for default log formats.
 type StandardLogger struct {
+	// accessed atomically, kept first to be 64-bit aligned on 32-bit platforms
+	metrics pipelineMetrics
+
 	*logrus.Logger
-	CustomFields    map[string]interface{}
-	logChan         chan Log
-	ddAPIKey        string
-	ddEndpoint      string
-	sendDebugLogs   bool
-	localMode       bool
-	httpClient      *http.Client
-	saveOfflineLogs bool
-	offlineLogsPath string
+	CustomFields        map[string]interface{}
+	queue               *logQueue
+	listenerOnce        sync.Once
+	closeOnce           sync.Once
+	closeLost           int
+	closeErr            error
+	ddAPIKey            string
+	ddEndpoint          string
+	sendDebugLogs       bool
+	localMode           bool
+	httpClient          *http.Client
+	saveOfflineLogs     bool
+	offlineLogsPath     string
+	spool               *spool
+	spoolConfig         SpoolConfig
+	spoolConfigSet      bool
+	spoolMu             sync.Mutex
+	batchConfig         BatchConfig
+	ddSink              *dataDogSink
+	ddRoute             *sinkRoute
+	ddMinLevel          logrus.Level
+	localRoute          *sinkRoute
+	sinks               []*sinkRoute
+	sinksMu             sync.RWMutex
+	serviceInfo         ServiceInfo
+	breakerConfig       CircuitBreakerConfig
+	ddFallbackEndpoints []string
+	sampler             *sampler
+	dedup               *deduplicator
+	fatalFlushTimeout   time.Duration
+	exitCode            int
+	exitFunc            func(code int)
+	exitHandlers        []func()
+	localFormatter      logrus.Formatter
+	localFormatterSet   bool
+	compression         Compression
+	retryPolicy         RetryPolicy
+	shipCtx             context.Context
+	cancelShip          context.CancelFunc
+	cloudWatch          *cloudWatchMetrics
+	staleOfflinePolicy  StaleOfflineLogPolicy
 }
 
 // Log is a type containing log message and level
@@ -25,6 +63,15 @@ type Log struct {
 	Message      string
 	CustomFields map[string]interface{}
 	Level        logrus.Level
+	// Time is when the log happened, the time it's handled is used if zero
+	Time time.Time
+	// template is the message before formatting, used by sampling and rate limits
+	template string
+	// sampleRate is the fraction of similar logs kept by sampling
+	sampleRate float64
+	// dataDogOnly is set on the logs replayed from the offline spool, which are shipped again
+	// only to DataDog since the other sinks already received them
+	dataDogOnly bool
 }
 
 // ClientLog is a struct used for offline logs